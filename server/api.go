@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/api/v1/questions" && r.Method == http.MethodGet:
+		p.serveQuestions(w, r, userID)
+	case r.URL.Path == "/api/v1/purge" && r.Method == http.MethodPost:
+		p.servePurge(w, r, userID)
+	case r.URL.Path == "/api/v1/channels" && r.Method == http.MethodGet:
+		p.serveChannels(w, r, userID)
+	case strings.HasPrefix(r.URL.Path, "/api/v1/channels/"):
+		p.serveChannel(w, r, userID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveChannel routes /api/v1/channels/{channel_id}/{action}.
+func (p *Plugin) serveChannel(w http.ResponseWriter, r *http.Request, userID string) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/channels/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	channelID, action := parts[0], parts[1]
+
+	switch {
+	case action == "export" && r.Method == http.MethodGet:
+		p.serveExport(w, channelID, userID)
+	case action == "import" && r.Method == http.MethodPost:
+		p.serveImport(w, r, channelID, userID)
+	default:
+		http.NotFound(w, r)
+	}
+}
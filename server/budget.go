@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	BudgetPeriodHour    = "hour"
+	BudgetPeriodSession = "session"
+)
+
+// BudgetAllowance is a quota that is used up by posts and refilled each period.
+// Session allowances only refill when a moderator resets the budget.
+type BudgetAllowance struct {
+	Limit       int    `json:"limit"` // 0 means unlimited
+	Period      string `json:"period"`
+	Used        int    `json:"used"`
+	WindowStart int64  `json:"window_start"` // Unix timestamp in milliseconds
+}
+
+func (a *BudgetAllowance) enabled() bool {
+	return a.Limit > 0
+}
+
+// roll starts a new window when the current hourly one has passed.
+func (a *BudgetAllowance) roll(now int64) {
+	if a.Period == BudgetPeriodHour && now-a.WindowStart >= time.Hour.Milliseconds() {
+		a.Used = 0
+		a.WindowStart = now
+	}
+}
+
+func (a *BudgetAllowance) fits(amount int) bool {
+	return !a.enabled() || a.Used+amount <= a.Limit
+}
+
+func (a *BudgetAllowance) String() string {
+	if !a.enabled() {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d/%d per %s", a.Limit-a.Used, a.Limit, a.Period)
+}
+
+// AgentBudget limits how much a single user (typically an AI agent) may post in a channel.
+type AgentBudget struct {
+	Posts     BudgetAllowance `json:"posts"`
+	Chars     BudgetAllowance `json:"chars"`
+	Exhausted bool            `json:"exhausted"` // Set once the agent has been auto-settled
+}
+
+func (b *AgentBudget) roll(now int64) {
+	b.Posts.roll(now)
+	b.Chars.roll(now)
+	if b.Exhausted && b.Posts.fits(1) && b.Chars.fits(1) {
+		b.Exhausted = false
+	}
+}
+
+func (b *AgentBudget) reset(now int64) {
+	b.Posts.Used, b.Posts.WindowStart = 0, now
+	b.Chars.Used, b.Chars.WindowStart = 0, now
+	b.Exhausted = false
+}
+
+// exhaustedUntil says when an agent whose post of chars characters did not fit may post
+// again. A spent session allowance outlasts any hourly one, since only a reset refills it.
+func (b *AgentBudget) exhaustedUntil(chars int) string {
+	if !b.Posts.fits(1) && b.Posts.Period == BudgetPeriodSession ||
+		!b.Chars.fits(chars) && b.Chars.Period == BudgetPeriodSession {
+		return "until its budget is reset"
+	}
+	return "until its hourly budget refills"
+}
+
+func (b *AgentBudget) String() string {
+	return fmt.Sprintf("posts %s, characters %s", b.Posts.String(), b.Chars.String())
+}
+
+// spendBudget charges the post against its author's budget in the channel, if any.
+// Once a budget runs out the agent is auto-settled: the post is silently dropped and
+// the channel is told once. It returns true if the post may go ahead.
+func (p *Plugin) spendBudget(post *model.Post, state *ChannelState) bool {
+	if _, ok := state.Budgets[post.UserId]; !ok {
+		return true
+	}
+
+	now := model.GetMillis()
+	chars := len([]rune(post.Message))
+
+	var allowed, newlyExhausted bool
+	var exhaustedUntil string
+	if _, err := p.updateChannelState(post.ChannelId, func(current *ChannelState) bool {
+		budget, ok := current.Budgets[post.UserId]
+		if !ok {
+			allowed = true
+			return false
+		}
+
+		budget.roll(now)
+		if budget.Posts.fits(1) && budget.Chars.fits(chars) {
+			budget.Posts.Used++
+			budget.Chars.Used += chars
+			allowed = true
+			return true
+		}
+
+		allowed = false
+		newlyExhausted = !budget.Exhausted
+		exhaustedUntil = budget.exhaustedUntil(chars)
+		budget.Exhausted = true
+		return newlyExhausted
+	}); err != nil {
+		p.API.LogError("Failed to update agent budget", "error", err.Error())
+		return true
+	}
+
+	if newlyExhausted {
+		username := post.UserId
+		if user, err := p.API.GetUser(post.UserId); err == nil && user != nil {
+			username = user.Username
+		}
+		// Announce outside the hook so the bot post does not re-enter MessageWillBePosted synchronously
+		go p.postAnnouncement(post.ChannelId, fmt.Sprintf("@%s has used up its message budget and has been settled %s.", username, exhaustedUntil))
+	}
+
+	return allowed
+}
+
+func (p *Plugin) executeBudget(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	usage := "Usage: `/stick budget @username <amount> <posts|chars>/<hour|session>`, `/stick budget @username reset` or `/stick budget @username off`"
+
+	if response := p.requireModerator(args, "Only administrators can change agent budgets."); response != nil {
+		return response, nil
+	}
+
+	if len(params) < 2 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         usage,
+		}, nil
+	}
+
+	username := strings.TrimPrefix(params[0], "@")
+	user, err := p.API.GetUserByUsername(username)
+	if err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("User @%s not found.", username),
+		}, nil
+	}
+
+	now := model.GetMillis()
+	var apply func(state *ChannelState)
+	var text string
+
+	switch params[1] {
+	case "off":
+		apply = func(state *ChannelState) { delete(state.Budgets, user.Id) }
+		text = fmt.Sprintf("@%s no longer has a message budget.", username)
+
+	case "reset":
+		apply = func(state *ChannelState) {
+			if budget, ok := state.Budgets[user.Id]; ok {
+				budget.reset(now)
+			}
+		}
+		text = fmt.Sprintf("@%s's message budget has been reset.", username)
+
+	default:
+		if len(params) < 3 {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         usage,
+			}, nil
+		}
+
+		amount, convErr := strconv.Atoi(params[1])
+		unit, period, found := strings.Cut(params[2], "/")
+		if convErr != nil || amount < 1 || !found ||
+			(unit != "posts" && unit != "chars") ||
+			(period != BudgetPeriodHour && period != BudgetPeriodSession) {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         usage,
+			}, nil
+		}
+
+		allowance := BudgetAllowance{Limit: amount, Period: period, WindowStart: now}
+		apply = func(state *ChannelState) {
+			budget, ok := state.Budgets[user.Id]
+			if !ok {
+				budget = &AgentBudget{}
+				state.Budgets[user.Id] = budget
+			}
+			if unit == "posts" {
+				budget.Posts = allowance
+			} else {
+				budget.Chars = allowance
+			}
+			budget.Exhausted = false
+		}
+		text = fmt.Sprintf("@%s may now post %d %s per %s in this channel.", username, amount, unit, period)
+	}
+
+	if _, err := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		apply(state)
+		return true
+	}); err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to update message budget.",
+		}, nil
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         text,
+	}, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+// bypassCacheTTL bounds how long a bypass decision is trusted. Role changes have no
+// plugin hook, so this is how quickly a promotion or demotion takes effect.
+const bypassCacheTTL = 30 * time.Second
+
+// bypassCacheMaxEntries triggers a sweep of expired entries when exceeded.
+const bypassCacheMaxEntries = 50000
+
+// clusterEventInvalidateBypass tells other nodes to drop cached bypass decisions for a user.
+const clusterEventInvalidateBypass = "invalidate_bypass"
+
+type bypassCacheEntry struct {
+	allowed bool
+	expires time.Time
+}
+
+// bypassCache holds canBypassTalkingStick decisions keyed by user and channel.
+type bypassCache struct {
+	mu      sync.Mutex
+	entries map[string]bypassCacheEntry
+}
+
+func newBypassCache() *bypassCache {
+	return &bypassCache{entries: make(map[string]bypassCacheEntry)}
+}
+
+func bypassCacheKey(userID, channelID string) string {
+	return userID + ":" + channelID
+}
+
+func (c *bypassCache) get(userID, channelID string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[bypassCacheKey(userID, channelID)]
+	if !ok || time.Now().After(entry.expires) {
+		return false, false
+	}
+	return entry.allowed, true
+}
+
+func (c *bypassCache) set(userID, channelID string, allowed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= bypassCacheMaxEntries {
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+	}
+
+	c.entries[bypassCacheKey(userID, channelID)] = bypassCacheEntry{
+		allowed: allowed,
+		expires: now.Add(bypassCacheTTL),
+	}
+}
+
+// removeUser drops every decision for userID, across all channels.
+func (c *bypassCache) removeUser(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prefix := userID + ":"
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// removeChannel drops every decision for channelID, across all users.
+func (c *bypassCache) removeChannel(channelID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	suffix := ":" + channelID
+	for key := range c.entries {
+		if strings.HasSuffix(key, suffix) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *bypassCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]bypassCacheEntry)
+}
+
+// invalidateBypass forgets cached bypass decisions for userID on every node.
+func (p *Plugin) invalidateBypass(userID string) {
+	p.bypassCache.removeUser(userID)
+
+	if err := p.API.PublishPluginClusterEvent(
+		model.PluginClusterEvent{Id: clusterEventInvalidateBypass, Data: []byte(userID)},
+		model.PluginClusterEventSendOptions{SendType: model.PluginClusterEventSendTypeReliable},
+	); err != nil {
+		p.API.LogWarn("Failed to publish bypass invalidation", "user_id", userID, "error", err.Error())
+	}
+}
+
+func (p *Plugin) UserHasJoinedChannel(c *plugin.Context, channelMember *model.ChannelMember, actor *model.User) {
+	p.invalidateBypass(channelMember.UserId)
+}
+
+func (p *Plugin) UserHasLeftChannel(c *plugin.Context, channelMember *model.ChannelMember, actor *model.User) {
+	p.invalidateBypass(channelMember.UserId)
+	p.removeUserFromChannel(channelMember.ChannelId, channelMember.UserId, false)
+}
+
+func (p *Plugin) UserHasJoinedTeam(c *plugin.Context, teamMember *model.TeamMember, actor *model.User) {
+	p.invalidateBypass(teamMember.UserId)
+}
+
+func (p *Plugin) UserHasLeftTeam(c *plugin.Context, teamMember *model.TeamMember, actor *model.User) {
+	p.invalidateBypass(teamMember.UserId)
+}
+
+func (p *Plugin) UserHasBeenDeactivated(c *plugin.Context, user *model.User) {
+	p.invalidateBypass(user.Id)
+	// Visiting every channel can take a while, so don't hold up the deactivation
+	go p.removeUserEverywhere(user.Id)
+}
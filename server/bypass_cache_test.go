@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+)
+
+// BenchmarkMessageWillBePosted measures the post hook for a regular member. The cached case
+// is the steady state; the uncached case forgets the channel state and bypass decision before
+// every post, so each one pays for the KV read and every user, channel and team lookup.
+func BenchmarkMessageWillBePosted(b *testing.B) {
+	channelID := model.NewId()
+	teamID := model.NewId()
+	userID := model.NewId()
+
+	api := &plugintest.API{}
+	api.On("KVGet", mock.Anything).Return(nil, nil)
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	api.On("GetUser", userID).Return(&model.User{Id: userID, Username: "member", Roles: model.SystemUserRoleId}, nil)
+	api.On("GetChannelMember", channelID, userID).Return(&model.ChannelMember{ChannelId: channelID, UserId: userID}, nil)
+	api.On("GetChannel", channelID).Return(&model.Channel{Id: channelID, TeamId: teamID}, nil).Maybe()
+	api.On("GetTeamMember", teamID, userID).Return(&model.TeamMember{TeamId: teamID, UserId: userID}, nil)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.stateCache = newChannelStateCache(stateCacheSize, stateCacheTTL)
+	p.bypassCache = newBypassCache()
+
+	run := func(b *testing.B, forget bool) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if forget {
+				b.StopTimer()
+				p.stateCache.remove(channelID)
+				p.bypassCache.clear()
+				b.StartTimer()
+			}
+
+			post := &model.Post{UserId: userID, ChannelId: channelID, Message: "hello"}
+			if _, reason := p.MessageWillBePosted(nil, post); reason != "" {
+				b.Fatalf("post rejected: %s", reason)
+			}
+		}
+	}
+
+	b.Run("cached", func(b *testing.B) { run(b, false) })
+	b.Run("uncached", func(b *testing.B) { run(b, true) })
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// clusterEventInvalidateChannelBypass tells other nodes to drop cached bypass decisions for a channel.
+const clusterEventInvalidateChannelBypass = "invalidate_channel_bypass"
+
+// BypassOverrides replaces the global Allow* settings in one channel. A nil field
+// inherits the global setting.
+type BypassOverrides struct {
+	SystemAdmins  *bool `json:"system_admins,omitempty"`
+	TeamAdmins    *bool `json:"team_admins,omitempty"`
+	ChannelAdmins *bool `json:"channel_admins,omitempty"`
+	Bots          *bool `json:"bots,omitempty"`
+}
+
+func (o BypassOverrides) isDefault() bool {
+	return o.SystemAdmins == nil && o.TeamAdmins == nil && o.ChannelAdmins == nil && o.Bots == nil
+}
+
+// field returns the override for a role name used by /stick bypass.
+func (o *BypassOverrides) field(role string) (**bool, bool) {
+	switch role {
+	case "system-admins":
+		return &o.SystemAdmins, true
+	case "team-admins":
+		return &o.TeamAdmins, true
+	case "channel-admins":
+		return &o.ChannelAdmins, true
+	case "bots":
+		return &o.Bots, true
+	default:
+		return nil, false
+	}
+}
+
+// bypassPolicy is the effective set of roles that bypass the talking stick in a channel.
+type bypassPolicy struct {
+	SystemAdmins  bool
+	TeamAdmins    bool
+	ChannelAdmins bool
+	Bots          bool
+}
+
+// effectiveBypassPolicy applies a channel's overrides on top of the global settings.
+func effectiveBypassPolicy(config *configuration, overrides BypassOverrides) bypassPolicy {
+	pick := func(override *bool, global bool) bool {
+		if override != nil {
+			return *override
+		}
+		return global
+	}
+
+	return bypassPolicy{
+		SystemAdmins:  pick(overrides.SystemAdmins, config.AllowSystemAdmins),
+		TeamAdmins:    pick(overrides.TeamAdmins, config.AllowTeamAdmins),
+		ChannelAdmins: pick(overrides.ChannelAdmins, config.AllowChannelAdmins),
+		Bots:          pick(overrides.Bots, config.AllowBots),
+	}
+}
+
+// parseUsernameList splits a setting of usernames, one per line or comma separated.
+func parseUsernameList(setting string) map[string]bool {
+	usernames := make(map[string]bool)
+	for _, field := range strings.FieldsFunc(setting, func(r rune) bool { return r == '\n' || r == ',' }) {
+		if username := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(field), "@")); username != "" {
+			usernames[username] = true
+		}
+	}
+	return usernames
+}
+
+// listedBypass checks the explicit bypass lists, which take precedence over roles. Being
+// on a "never" list, in the channel or globally, wins over being on an "always" list.
+func listedBypass(config *configuration, state *ChannelState, user *model.User) (allowed bool, listed bool) {
+	channelEntry, inChannel := state.BypassUsers[user.Id]
+	username := strings.ToLower(user.Username)
+
+	if (inChannel && !channelEntry) || parseUsernameList(config.NeverBypassUsers)[username] {
+		return false, true
+	}
+	if (inChannel && channelEntry) || parseUsernameList(config.AlwaysBypassUsers)[username] {
+		return true, true
+	}
+	return false, false
+}
+
+// describeBypassPolicy renders the effective policy, marking channel overrides and
+// listing users who always or never bypass here.
+func (p *Plugin) describeBypassPolicy(state *ChannelState) string {
+	config := p.getConfiguration()
+	overrides := state.BypassOverrides
+	policy := effectiveBypassPolicy(config, overrides)
+
+	line := func(name string, allowed bool, override *bool) string {
+		value := "no"
+		if allowed {
+			value = "yes"
+		}
+		source := "global setting"
+		if override != nil {
+			source = "channel override"
+		}
+		return fmt.Sprintf("- %s: %s (%s)", name, value, source)
+	}
+
+	lines := []string{
+		line("System admins", policy.SystemAdmins, overrides.SystemAdmins),
+		line("Team admins", policy.TeamAdmins, overrides.TeamAdmins),
+		line("Channel admins", policy.ChannelAdmins, overrides.ChannelAdmins),
+		line("Bots", policy.Bots, overrides.Bots),
+	}
+
+	always := parseUsernameList(config.AlwaysBypassUsers)
+	never := parseUsernameList(config.NeverBypassUsers)
+	for userID, allowed := range state.BypassUsers {
+		user, err := p.API.GetUser(userID)
+		if err != nil || user == nil {
+			p.API.LogWarn("Failed to get user for bypass list", "user_id", userID, "error", err)
+			continue
+		}
+		if allowed {
+			always[strings.ToLower(user.Username)] = true
+		} else {
+			never[strings.ToLower(user.Username)] = true
+		}
+	}
+	if names := sortedMentions(always); names != "" {
+		lines = append(lines, "- Always bypass: "+names)
+	}
+	if names := sortedMentions(never); names != "" {
+		lines = append(lines, "- Never bypass: "+names)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// sortedMentions renders a set of usernames as sorted @mentions.
+func sortedMentions(usernames map[string]bool) string {
+	var names []string
+	for username := range usernames {
+		names = append(names, "@"+username)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// invalidateChannelBypass forgets cached bypass decisions for channelID on every node.
+func (p *Plugin) invalidateChannelBypass(channelID string) {
+	p.bypassCache.removeChannel(channelID)
+
+	if err := p.API.PublishPluginClusterEvent(
+		model.PluginClusterEvent{Id: clusterEventInvalidateChannelBypass, Data: []byte(channelID)},
+		model.PluginClusterEventSendOptions{SendType: model.PluginClusterEventSendTypeReliable},
+	); err != nil {
+		p.API.LogWarn("Failed to publish channel bypass invalidation", "channel_id", channelID, "error", err.Error())
+	}
+}
+
+func (p *Plugin) executeBypass(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	usage := "Usage: `/stick bypass [system-admins|team-admins|channel-admins|bots] [on|off|default]`, `/stick bypass [always|never|unlist] @username [@username...]` or `/stick bypass reset`"
+
+	if len(params) == 0 {
+		state, err := p.getChannelState(args.ChannelId)
+		if err != nil {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         "Failed to get channel state.",
+			}, nil
+		}
+
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("### Bypass Policy\n\n%s", p.describeBypassPolicy(state)),
+		}, nil
+	}
+
+	if response := p.requireModerator(args, "Only administrators can change the bypass policy."); response != nil {
+		return response, nil
+	}
+
+	if params[0] == "always" || params[0] == "never" || params[0] == "unlist" {
+		return p.executeBypassList(args, params[0], params[1:])
+	}
+
+	var apply func(state *ChannelState)
+
+	if len(params) == 1 && params[0] == "reset" {
+		apply = func(state *ChannelState) {
+			state.BypassOverrides = BypassOverrides{}
+			state.BypassUsers = make(map[string]bool)
+		}
+	} else {
+		if len(params) != 2 {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         usage,
+			}, nil
+		}
+		if _, ok := (&BypassOverrides{}).field(params[0]); !ok {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         usage,
+			}, nil
+		}
+
+		var value *bool
+		switch params[1] {
+		case "on":
+			value = model.NewPointer(true)
+		case "off":
+			value = model.NewPointer(false)
+		case "default":
+			value = nil
+		default:
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         usage,
+			}, nil
+		}
+
+		role := params[0]
+		apply = func(state *ChannelState) {
+			field, _ := state.BypassOverrides.field(role)
+			*field = value
+		}
+	}
+
+	state, appErr := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		apply(state)
+		return true
+	})
+	if appErr != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to update the bypass policy.",
+		}, nil
+	}
+	p.invalidateChannelBypass(args.ChannelId)
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         fmt.Sprintf("Bypass policy updated.\n\n%s", p.describeBypassPolicy(state)),
+	}, nil
+}
+
+// executeBypassList adds users to the channel's always or never bypass list, or removes
+// them from both with "unlist".
+func (p *Plugin) executeBypassList(args *model.CommandArgs, list string, params []string) (*model.CommandResponse, *model.AppError) {
+	if len(params) == 0 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("Usage: `/stick bypass %s @username [@username...]`", list),
+		}, nil
+	}
+
+	targets := p.resolveTargets(params, false)
+	if len(targets.notFound) > 0 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("User not found: %s", strings.Join(targets.notFound, ", ")),
+		}, nil
+	}
+
+	state, appErr := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		for userID := range targets.users {
+			if list == "unlist" {
+				delete(state.BypassUsers, userID)
+			} else {
+				state.BypassUsers[userID] = list == "always"
+			}
+		}
+		return true
+	})
+	if appErr != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to update the bypass policy.",
+		}, nil
+	}
+	p.invalidateChannelBypass(args.ChannelId)
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         fmt.Sprintf("Bypass policy updated.\n\n%s", p.describeBypassPolicy(state)),
+	}, nil
+}
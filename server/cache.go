@@ -0,0 +1,136 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+// stateCacheSize bounds the number of channels whose state is kept in memory per node.
+const stateCacheSize = 10000
+
+// stateCacheTTL bounds how long a node can serve state it missed an invalidation for.
+const stateCacheTTL = time.Minute
+
+// clusterEventInvalidateState tells other nodes to drop a channel from their state cache.
+const clusterEventInvalidateState = "invalidate_channel_state"
+
+type stateCacheEntry struct {
+	channelID string
+	data      []byte // Raw stored state, nil when the channel has no state
+	storedAt  time.Time
+}
+
+// channelStateCache is an LRU of the raw channel_<id> KV values. Channels without
+// stored state are cached too, so the post hook skips the KV store for channels
+// that have never used the plugin.
+//
+// Every invalidation bumps generation. Callers take the generation before reading
+// the KV store and pass it to set, which drops the value if an invalidation arrived
+// in between, so a slow read can't cache state that another node has replaced.
+type channelStateCache struct {
+	mu         sync.Mutex
+	capacity   int
+	ttl        time.Duration
+	generation uint64
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+func newChannelStateCache(capacity int, ttl time.Duration) *channelStateCache {
+	return &channelStateCache{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *channelStateCache) get(channelID string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[channelID]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*stateCacheEntry)
+	if time.Since(entry.storedAt) > c.ttl {
+		c.order.Remove(elem)
+		delete(c.entries, channelID)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.data, true
+}
+
+// currentGeneration returns the token to pass to set for a value about to be read.
+func (c *channelStateCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+// set caches data read at generation gen, unless the cache was invalidated since.
+func (c *channelStateCache) set(channelID string, data []byte, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.generation {
+		return
+	}
+
+	if elem, ok := c.entries[channelID]; ok {
+		entry := elem.Value.(*stateCacheEntry)
+		entry.data = data
+		entry.storedAt = time.Now()
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[channelID] = c.order.PushFront(&stateCacheEntry{channelID: channelID, data: data, storedAt: time.Now()})
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*stateCacheEntry).channelID)
+	}
+}
+
+func (c *channelStateCache) remove(channelID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if elem, ok := c.entries[channelID]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, channelID)
+	}
+}
+
+// publishStateInvalidation tells every other node to drop channelID from its state cache.
+func (p *Plugin) publishStateInvalidation(channelID string) {
+	if err := p.API.PublishPluginClusterEvent(
+		model.PluginClusterEvent{Id: clusterEventInvalidateState, Data: []byte(channelID)},
+		model.PluginClusterEventSendOptions{SendType: model.PluginClusterEventSendTypeReliable},
+	); err != nil {
+		p.API.LogWarn("Failed to publish channel state invalidation", "channel_id", channelID, "error", err.Error())
+	}
+}
+
+func (p *Plugin) OnPluginClusterEvent(c *plugin.Context, ev model.PluginClusterEvent) {
+	switch ev.Id {
+	case clusterEventInvalidateState:
+		p.stateCache.remove(string(ev.Data))
+	case clusterEventInvalidateBypass:
+		p.bypassCache.removeUser(string(ev.Data))
+	case clusterEventInvalidateChannelBypass:
+		p.bypassCache.removeChannel(string(ev.Data))
+	case clusterEventReloadGlobalSettle:
+		p.loadGlobalSettle()
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// isDefault reports whether the state is indistinguishable from a channel that has
+// never used the plugin, in which case it does not need to be stored at all.
+// Q&A session bookkeeping is ignored since it has no effect once everything else is reset.
+func (s *ChannelState) isDefault() bool {
+	return (s.Mode == ModeOpen || s.Mode == "") &&
+		len(s.Speakers) == 0 &&
+		len(s.SpeakerGroups) == 0 &&
+		len(s.QASlots) == 0 &&
+		s.SettleUntil == 0 &&
+		s.SettleScope == "" &&
+		s.SettleLimits.isDefault() &&
+		s.SettleRelease == "" &&
+		len(s.Strikes) == 0 &&
+		len(s.SettleAgents) == 0 &&
+		s.QAPolicy.isDefault() &&
+		!s.SlowMode.enabled() &&
+		len(s.Budgets) == 0 &&
+		!s.LengthCaps.enabled() &&
+		!s.FreezeEdits &&
+		s.BypassOverrides.isDefault() &&
+		len(s.BypassUsers) == 0
+}
+
+// removeUser drops the per-user entries for userID and reports whether anything changed.
+// Budgets, strikes, mutes and bypass listings survive leaving the channel, so they still
+// apply if the user rejoins; they are only dropped once the user is deactivated.
+func (s *ChannelState) removeUser(userID string, deactivated bool) bool {
+	_, isSpeaker := s.Speakers[userID]
+	_, hasSlots := s.QASlots[userID]
+
+	delete(s.Speakers, userID)
+	delete(s.QASlots, userID)
+	delete(s.QAUsed, userID)
+	delete(s.QALastRefill, userID)
+
+	hasBudget, isListed, hasStrikes := false, false, false
+	if deactivated {
+		_, hasBudget = s.Budgets[userID]
+		delete(s.Budgets, userID)
+		_, isListed = s.BypassUsers[userID]
+		delete(s.BypassUsers, userID)
+		_, hasStrikes = s.Strikes[userID]
+		delete(s.Strikes, userID)
+	}
+
+	return isSpeaker || hasSlots || hasBudget || isListed || hasStrikes
+}
+
+// stateUserIDs returns the users that have per-user entries in the state.
+func (s *ChannelState) stateUserIDs() map[string]bool {
+	userIDs := make(map[string]bool)
+	for userID := range s.Speakers {
+		userIDs[userID] = true
+	}
+	for userID := range s.QASlots {
+		userIDs[userID] = true
+	}
+	for userID := range s.Budgets {
+		userIDs[userID] = true
+	}
+	for userID := range s.BypassUsers {
+		userIDs[userID] = true
+	}
+	for userID := range s.Strikes {
+		userIDs[userID] = true
+	}
+	return userIDs
+}
+
+// removeUserFromChannel prunes userID's grants and slots from one channel, and their
+// budget, bypass listing and strikes too when they have been deactivated.
+func (p *Plugin) removeUserFromChannel(channelID, userID string, deactivated bool) {
+	state, appErr := p.getChannelState(channelID)
+	if appErr != nil {
+		p.API.LogError("Failed to get channel state for cleanup", "channel_id", channelID, "error", appErr.Error())
+		return
+	}
+	if !state.stateUserIDs()[userID] {
+		return
+	}
+
+	if _, appErr := p.updateChannelState(channelID, func(state *ChannelState) bool {
+		return state.removeUser(userID, deactivated)
+	}); appErr != nil {
+		p.API.LogError("Failed to remove user from channel state", "channel_id", channelID, "user_id", userID, "error", appErr.Error())
+	}
+}
+
+// removeUserEverywhere prunes userID from every channel with stored state.
+func (p *Plugin) removeUserEverywhere(userID string) {
+	channelIDs, appErr := p.listStateChannelIDs()
+	if appErr != nil {
+		p.API.LogError("Failed to list channels for user cleanup", "user_id", userID, "error", appErr.Error())
+		return
+	}
+
+	for _, channelID := range channelIDs {
+		p.removeUserFromChannel(channelID, userID, true)
+	}
+}
+
+// isStaleUser reports whether userID has left the channel or been deactivated, and
+// which of the two. Lookup failures other than "not found" are treated as not stale.
+func (p *Plugin) isStaleUser(channelID, userID string) (stale, deactivated bool) {
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		notFound := appErr.StatusCode == http.StatusNotFound
+		return notFound, notFound
+	}
+	if user.DeleteAt != 0 {
+		return true, true
+	}
+
+	if _, appErr := p.API.GetChannelMember(channelID, userID); appErr != nil {
+		return appErr.StatusCode == http.StatusNotFound, false
+	}
+	return false, false
+}
+
+// sweepStaleUsers prunes departed and deactivated users from every channel and drops
+// state that has returned to defaults. It runs as a cluster-wide scheduled job and
+// catches anything the membership hooks missed.
+func (p *Plugin) sweepStaleUsers() {
+	channelIDs, appErr := p.listStateChannelIDs()
+	if appErr != nil {
+		p.API.LogError("Failed to list channels for stale user sweep", "error", appErr.Error())
+		return
+	}
+
+	for _, channelID := range channelIDs {
+		state, appErr := p.getChannelState(channelID)
+		if appErr != nil {
+			p.API.LogError("Failed to get channel state for stale user sweep", "channel_id", channelID, "error", appErr.Error())
+			continue
+		}
+
+		stale := make(map[string]bool) // Stale user IDs, mapped to whether they were deactivated
+		for userID := range state.stateUserIDs() {
+			if isStale, deactivated := p.isStaleUser(channelID, userID); isStale {
+				stale[userID] = deactivated
+			}
+		}
+
+		if len(stale) == 0 && !state.isDefault() {
+			continue
+		}
+
+		// Writing a default state deletes the key, so this also drops emptied channels
+		if _, appErr := p.updateChannelState(channelID, func(state *ChannelState) bool {
+			changed := false
+			for userID, deactivated := range stale {
+				if state.removeUser(userID, deactivated) {
+					changed = true
+				}
+			}
+			return changed || state.isDefault()
+		}); appErr != nil {
+			p.API.LogError("Failed to prune stale users", "channel_id", channelID, "error", appErr.Error())
+		}
+	}
+}
+
+// deleteChannelState removes the stored state if it still matches oldData.
+func (p *Plugin) deleteChannelState(channelID string, oldData []byte) *model.AppError {
+	if oldData == nil {
+		return nil // Nothing stored
+	}
+
+	key := "channel_" + channelID
+	gen := p.stateCache.currentGeneration()
+	ok, appErr := p.API.KVCompareAndDelete(key, oldData)
+	if appErr != nil {
+		p.stateCache.remove(channelID)
+		return model.NewAppError("setChannelState", "app.plugin.kv_delete.app_error", nil, "", 500)
+	}
+	if !ok {
+		p.stateCache.remove(channelID)
+		return model.NewAppError("setChannelState", "app.plugin.kv_conflict.app_error", nil, "", 409)
+	}
+
+	p.stateCache.set(channelID, nil, gen)
+	p.publishStateInvalidation(channelID)
+	return nil
+}
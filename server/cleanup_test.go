@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveUser(t *testing.T) {
+	const userID = "agent"
+	newState := func() *ChannelState {
+		state := newChannelState()
+		state.Speakers[userID] = &SpeakerGrant{}
+		state.QASlots[userID] = 2
+		state.Budgets[userID] = &AgentBudget{}
+		state.BypassUsers[userID] = false
+		state.Strikes[userID] = &AgentStrikes{Muted: true}
+		return state
+	}
+
+	t.Run("leaving keeps budgets, listings and strikes", func(t *testing.T) {
+		state := newState()
+		assert.True(t, state.removeUser(userID, false))
+
+		assert.NotContains(t, state.Speakers, userID)
+		assert.NotContains(t, state.QASlots, userID)
+		assert.Contains(t, state.Budgets, userID)
+		assert.Contains(t, state.BypassUsers, userID)
+		assert.True(t, state.Strikes[userID].Muted)
+
+		assert.False(t, state.removeUser(userID, false), "nothing left to remove on leave")
+	})
+
+	t.Run("deactivation removes everything", func(t *testing.T) {
+		state := newState()
+		assert.True(t, state.removeUser(userID, true))
+
+		assert.Empty(t, state.stateUserIDs())
+	})
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -9,84 +10,230 @@ import (
 	"github.com/mattermost/mattermost/server/public/model"
 )
 
+// commandTargets are the users and groups named in a command, keyed by ID with the
+// name as typed (without the @).
+type commandTargets struct {
+	users    map[string]string
+	groups   map[string]string
+	notFound []string
+}
+
+// mentions lists the targets for an announcement, e.g. "@alice, @bob and group @panelists".
+func (t *commandTargets) mentions() string {
+	var names []string
+	for _, username := range t.users {
+		names = append(names, "@"+username)
+	}
+	for _, groupName := range t.groups {
+		names = append(names, "group @"+groupName)
+	}
+	sort.Strings(names)
+
+	if len(names) <= 1 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// resolveTargets looks up each @mention as a user, or failing that as a group when
+// allowGroups is set.
+func (p *Plugin) resolveTargets(params []string, allowGroups bool) *commandTargets {
+	targets := &commandTargets{
+		users:  make(map[string]string),
+		groups: make(map[string]string),
+	}
+
+	for _, param := range params {
+		name := strings.TrimPrefix(param, "@")
+		if user, err := p.API.GetUserByUsername(name); err == nil {
+			targets.users[user.Id] = name
+			continue
+		}
+		if allowGroups {
+			if group, ok := p.getGroupByName(name); ok {
+				targets.groups[group.Id] = name
+				continue
+			}
+		}
+		targets.notFound = append(targets.notFound, "@"+name)
+	}
+
+	return targets
+}
+
 func (p *Plugin) executeGrant(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	if response := p.requireModerator(args, "Only administrators can grant speaking privileges."); response != nil {
+		return response, nil
+	}
+
 	if len(params) == 0 {
 		return &model.CommandResponse{
 			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Usage: `/stick grant @username`",
+			Text:         "Usage: `/stick grant @username [@username...] [duration]`",
 		}, nil
 	}
 
-	username := strings.TrimPrefix(params[0], "@")
-	user, err := p.API.GetUserByUsername(username)
-	if err != nil {
+	// An optional trailing duration makes the grants expire on their own; anything
+	// else is a username
+	var expiresIn time.Duration
+	if parsed, err := time.ParseDuration(params[len(params)-1]); err == nil {
+		if parsed < time.Minute {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         "Invalid duration. Use a duration of at least a minute, such as `15m` or `2h`.",
+			}, nil
+		}
+		expiresIn = parsed
+		params = params[:len(params)-1]
+	}
+
+	if len(params) == 0 {
 		return &model.CommandResponse{
 			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         fmt.Sprintf("User @%s not found.", username),
+			Text:         "Usage: `/stick grant @username [@username...] [duration]`",
 		}, nil
 	}
 
-	state, err := p.getChannelState(args.ChannelId)
-	if err != nil {
+	targets := p.resolveTargets(params, true)
+	if len(targets.notFound) > 0 {
 		return &model.CommandResponse{
 			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Failed to get channel state.",
+			Text:         fmt.Sprintf("User or group not found: %s", strings.Join(targets.notFound, ", ")),
 		}, nil
 	}
 
-	state.Speakers[user.Id] = true
+	now := model.GetMillis()
+	grant := SpeakerGrant{GrantedBy: args.UserId, GrantedAt: now}
+	if expiresIn > 0 {
+		grant.ExpiresAt = now + expiresIn.Milliseconds()
+	}
 
-	if err := p.setChannelState(args.ChannelId, state); err != nil {
+	if _, err := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		for userID := range targets.users {
+			userGrant := grant
+			state.Speakers[userID] = &userGrant
+		}
+		for groupID := range targets.groups {
+			groupGrant := grant
+			state.SpeakerGroups[groupID] = &groupGrant
+		}
+		return true
+	}); err != nil {
 		return &model.CommandResponse{
 			ResponseType: model.CommandResponseTypeEphemeral,
 			Text:         "Failed to grant speaking privileges.",
 		}, nil
 	}
 
+	text := fmt.Sprintf("%s granted speaking privileges", withVerb(targets.mentions(), len(targets.users)+len(targets.groups)))
+	if expiresIn > 0 {
+		text += fmt.Sprintf(" for %s", formatSettleDuration(expiresIn))
+	}
+
 	return &model.CommandResponse{
 		ResponseType: model.CommandResponseTypeInChannel,
-		Text:         fmt.Sprintf("@%s has been granted speaking privileges.", username),
+		Text:         text + ".",
 	}, nil
 }
 
 func (p *Plugin) executeRevoke(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	if response := p.requireModerator(args, "Only administrators can revoke speaking privileges."); response != nil {
+		return response, nil
+	}
+
 	if len(params) == 0 {
 		return &model.CommandResponse{
 			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Usage: `/stick revoke @username`",
+			Text:         "Usage: `/stick revoke @username [@username...]` or `/stick revoke --all`",
 		}, nil
 	}
 
-	username := strings.TrimPrefix(params[0], "@")
-	user, err := p.API.GetUserByUsername(username)
-	if err != nil {
+	if params[0] == "--all" {
+		if _, err := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+			state.Speakers = make(map[string]*SpeakerGrant)
+			state.SpeakerGroups = make(map[string]*SpeakerGrant)
+			state.QASlots = make(map[string]int)
+			return true
+		}); err != nil {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         "Failed to revoke speaking privileges.",
+			}, nil
+		}
+
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeInChannel,
+			Text:         "All speaking privileges and Q&A slots have been revoked.",
+		}, nil
+	}
+
+	targets := p.resolveTargets(params, true)
+	if len(targets.notFound) > 0 {
 		return &model.CommandResponse{
 			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         fmt.Sprintf("User @%s not found.", username),
+			Text:         fmt.Sprintf("User or group not found: %s", strings.Join(targets.notFound, ", ")),
 		}, nil
 	}
 
-	state, err := p.getChannelState(args.ChannelId)
-	if err != nil {
+	if _, err := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		for userID := range targets.users {
+			delete(state.Speakers, userID)
+			delete(state.QASlots, userID)
+		}
+		for groupID := range targets.groups {
+			delete(state.SpeakerGroups, groupID)
+		}
+		return true
+	}); err != nil {
 		return &model.CommandResponse{
 			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Failed to get channel state.",
+			Text:         "Failed to revoke speaking privileges.",
 		}, nil
 	}
 
-	delete(state.Speakers, user.Id)
-	delete(state.QASlots, user.Id)
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         fmt.Sprintf("Speaking privileges have been revoked for %s.", targets.mentions()),
+	}, nil
+}
 
-	if err := p.setChannelState(args.ChannelId, state); err != nil {
+// withVerb appends "has been"/"have been" to subject to agree with count.
+func withVerb(subject string, count int) string {
+	if count == 1 {
+		if strings.HasPrefix(subject, "group ") {
+			return "Members of " + subject + " have been"
+		}
+		return subject + " has been"
+	}
+	return subject + " have been"
+}
+
+func (p *Plugin) executeReset(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	// Reset also ends a settle, so it is held to the same rule as /settle off
+	if response := p.requireSettlePermission(args); response != nil {
+		return response, nil
+	}
+
+	if _, err := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		state.Mode = ModeOpen
+		state.Speakers = make(map[string]*SpeakerGrant)
+		state.SpeakerGroups = make(map[string]*SpeakerGrant)
+		state.QASlots = make(map[string]int)
+		state.startQASession(0)
+		state.clearSettle()
+		return true
+	}); err != nil {
 		return &model.CommandResponse{
 			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Failed to revoke speaking privileges.",
+			Text:         "Failed to reset the channel.",
 		}, nil
 	}
+	p.clearQuestionBoard(args.ChannelId)
+	go p.releaseHeldPosts(args.ChannelId)
 
 	return &model.CommandResponse{
 		ResponseType: model.CommandResponseTypeInChannel,
-		Text:         fmt.Sprintf("@%s has had their speaking privileges revoked.", username),
+		Text:         "The talking stick has been reset: speakers, Q&A slots, questions and settle were cleared and the channel is **open**.",
 	}, nil
 }
 
@@ -99,14 +246,30 @@ func (p *Plugin) executeList(args *model.CommandArgs) (*model.CommandResponse, *
 		}, nil
 	}
 
+	now := model.GetMillis()
+
 	var speakers []string
-	for userID := range state.Speakers {
+	for userID, grant := range state.Speakers {
+		if !grant.active(now) {
+			continue
+		}
 		user, err := p.API.GetUser(userID)
 		if err != nil || user == nil {
 			p.API.LogWarn("Failed to get user for speaker list", "user_id", userID, "error", err)
 			continue
 		}
-		speakers = append(speakers, fmt.Sprintf("@%s", user.Username))
+		speakers = append(speakers, fmt.Sprintf("@%s%s", user.Username, grant.describe(now)))
+	}
+	for groupID, grant := range state.SpeakerGroups {
+		if !grant.active(now) {
+			continue
+		}
+		group, err := p.API.GetGroup(groupID)
+		if err != nil || group == nil || group.Name == nil {
+			p.API.LogWarn("Failed to get group for speaker list", "group_id", groupID, "error", err)
+			continue
+		}
+		speakers = append(speakers, fmt.Sprintf("@%s (group)%s", *group.Name, grant.describe(now)))
 	}
 
 	var qaParticipants []string
@@ -130,7 +293,43 @@ func (p *Plugin) executeList(args *model.CommandArgs) (*model.CommandResponse, *
 	}
 
 	if len(qaParticipants) > 0 {
-		text += fmt.Sprintf("**Q&A Participants:** %s", strings.Join(qaParticipants, ", "))
+		text += fmt.Sprintf("**Q&A Participants:** %s\n\n", strings.Join(qaParticipants, ", "))
+	}
+
+	var budgets []string
+	for userID, budget := range state.Budgets {
+		user, err := p.API.GetUser(userID)
+		if err != nil || user == nil {
+			p.API.LogWarn("Failed to get user for budget list", "user_id", userID, "error", err)
+			continue
+		}
+		budget.roll(now)
+		status := ""
+		if budget.Exhausted {
+			status = " - **exhausted, settled**"
+		}
+		budgets = append(budgets, fmt.Sprintf("- @%s: %s%s", user.Username, budget, status))
+	}
+	if len(budgets) > 0 {
+		text += fmt.Sprintf("**Budgets:**\n%s\n\n", strings.Join(budgets, "\n"))
+	}
+
+	if state.LengthCaps.enabled() {
+		text += fmt.Sprintf("**Message Length Caps:**\n%s\n\n", describeLengthCaps(state.LengthCaps))
+	}
+
+	if state.SlowMode.enabled() {
+		text += fmt.Sprintf("**Slow Mode:**\n%s\n\n", describeSlowMode(state.SlowMode))
+	}
+
+	text += fmt.Sprintf("**Bypass Policy:**\n%s\n\n", p.describeBypassPolicy(state))
+
+	if state.FreezeEdits {
+		text += "**Edits:** frozen while locked\n\n"
+	}
+
+	if !state.QAPolicy.isDefault() {
+		text += fmt.Sprintf("**Q&A Slot Policy:**\n%s", describeQAPolicy(state.QAPolicy))
 	}
 
 	return &model.CommandResponse{
@@ -140,6 +339,10 @@ func (p *Plugin) executeList(args *model.CommandArgs) (*model.CommandResponse, *
 }
 
 func (p *Plugin) executeMode(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	if response := p.requireModerator(args, "Only administrators can change the channel mode."); response != nil {
+		return response, nil
+	}
+
 	if len(params) == 0 {
 		return &model.CommandResponse{
 			ResponseType: model.CommandResponseTypeEphemeral,
@@ -162,22 +365,23 @@ func (p *Plugin) executeMode(args *model.CommandArgs, params []string) (*model.C
 		}, nil
 	}
 
-	state, err := p.getChannelState(args.ChannelId)
-	if err != nil {
-		return &model.CommandResponse{
-			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Failed to get channel state.",
-		}, nil
-	}
-
-	state.Mode = mode
-
-	if err := p.setChannelState(args.ChannelId, state); err != nil {
+	sessionStarted := false
+	if _, err := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		sessionStarted = mode == ModeQA && state.Mode != ModeQA
+		if sessionStarted {
+			state.startQASession(model.GetMillis())
+		}
+		state.Mode = mode
+		return true
+	}); err != nil {
 		return &model.CommandResponse{
 			ResponseType: model.CommandResponseTypeEphemeral,
 			Text:         "Failed to set channel mode.",
 		}, nil
 	}
+	if sessionStarted {
+		p.clearQuestionBoard(args.ChannelId)
+	}
 
 	modeDescriptions := map[ChannelMode]string{
 		ModeOpen:         "everyone can post",
@@ -193,226 +397,65 @@ func (p *Plugin) executeMode(args *model.CommandArgs, params []string) (*model.C
 }
 
 func (p *Plugin) executeQAGrant(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
-	if len(params) == 0 {
-		return &model.CommandResponse{
-			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Usage: `/stick qa-grant @username [count]`",
-		}, nil
+	if response := p.requireModerator(args, "Only administrators can grant question slots."); response != nil {
+		return response, nil
 	}
 
-	username := strings.TrimPrefix(params[0], "@")
-	user, err := p.API.GetUserByUsername(username)
-	if err != nil {
+	if len(params) == 0 {
 		return &model.CommandResponse{
 			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         fmt.Sprintf("User @%s not found.", username),
+			Text:         "Usage: `/stick qa-grant @username [@username...] [count]`",
 		}, nil
 	}
 
+	// An optional trailing count applies to every user; anything else is a username
 	slots := 1
-	if len(params) > 1 {
-		parsed, err := strconv.Atoi(params[1])
-		if err != nil || parsed < 1 {
+	usernames := params
+	if parsed, err := strconv.Atoi(params[len(params)-1]); err == nil {
+		if parsed < 1 {
 			return &model.CommandResponse{
 				ResponseType: model.CommandResponseTypeEphemeral,
 				Text:         "Invalid slot count. Must be a positive number.",
 			}, nil
 		}
 		slots = parsed
+		usernames = params[:len(params)-1]
 	}
 
-	state, err := p.getChannelState(args.ChannelId)
-	if err != nil {
+	if len(usernames) == 0 {
 		return &model.CommandResponse{
 			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Failed to get channel state.",
+			Text:         "Usage: `/stick qa-grant @username [@username...] [count]`",
 		}, nil
 	}
 
-	state.QASlots[user.Id] = slots
-
-	if err := p.setChannelState(args.ChannelId, state); err != nil {
+	targets := p.resolveTargets(usernames, false)
+	if len(targets.notFound) > 0 {
 		return &model.CommandResponse{
 			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Failed to grant Q&A slots.",
+			Text:         fmt.Sprintf("User not found: %s", strings.Join(targets.notFound, ", ")),
 		}, nil
 	}
 
-	slotText := "slot"
-	if slots > 1 {
-		slotText = "slots"
-	}
-
-	return &model.CommandResponse{
-		ResponseType: model.CommandResponseTypeInChannel,
-		Text:         fmt.Sprintf("@%s has been granted %d Q&A %s.", username, slots, slotText),
-	}, nil
-}
-
-func (p *Plugin) settleHelpResponse() *model.CommandResponse {
-	help := `### Settle Command
-
-Temporarily suppress agent responses to break doom loops.
-
-**Usage:**
-- ` + "`/settle`" + ` - Settle all agents for 20 seconds (default)
-- ` + "`/settle 45`" + ` - Settle all agents for 45 seconds
-- ` + "`/settle @telos`" + ` - Settle specific agent for 20 seconds
-- ` + "`/settle 30 @telos @aurora`" + ` - Settle specific agents for 30 seconds
-- ` + "`/settle status`" + ` - Check current settle state
-
-**Notes:**
-- Only administrators can use this command
-- Maximum settle duration: 300 seconds (5 minutes)
-- Responses from settled agents will vanish completely
-- Settle expires silently (no announcement)
-`
-
-	return &model.CommandResponse{
-		ResponseType: model.CommandResponseTypeEphemeral,
-		Text:         help,
-	}
-}
-
-func (p *Plugin) executeSettle(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
-	// Admin check - only admins can use settle
-	canBypass, err := p.canBypassTalkingStick(args.UserId, args.ChannelId)
-	if err != nil {
-		return &model.CommandResponse{
-			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Failed to check permissions.",
-		}, nil
-	}
-	if !canBypass {
-		return &model.CommandResponse{
-			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Only administrators can use the settle command.",
-		}, nil
-	}
-
-	// Parse params: /settle [seconds] [@user1 @user2...]
-	// Examples: /settle, /settle 45, /settle @telos, /settle 30 @telos @aurora
-
-	seconds := 20 // Default 20 seconds
-	var targetUsernames []string
-
-	for _, param := range params {
-		if strings.HasPrefix(param, "@") {
-			// It's a username
-			targetUsernames = append(targetUsernames, strings.TrimPrefix(param, "@"))
-		} else {
-			// Try to parse as seconds
-			parsed, err := strconv.Atoi(param)
-			if err == nil && parsed > 0 && parsed <= 300 { // Max 5 minutes
-				seconds = parsed
-			}
+	if _, err := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		for userID := range targets.users {
+			state.QASlots[userID] = slots
 		}
-	}
-
-	// Get current state
-	state, appErr := p.getChannelState(args.ChannelId)
-	if appErr != nil {
+		return true
+	}); err != nil {
 		return &model.CommandResponse{
 			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Failed to get channel state.",
-		}, nil
-	}
-
-	// Save the current mode so we can restore it later
-	previousMode := state.Mode
-
-	// Set settle state
-	state.SettleUntil = model.GetMillis() + int64(seconds*1000)
-	state.PreviousMode = previousMode
-
-	if len(targetUsernames) == 0 {
-		// Settle all - lock the channel
-		state.SettleAgents = []string{"all"}
-		state.Mode = ModeLocked
-	} else {
-		// Settle specific users - keep current mode, let MessageWillBePosted handle it
-		state.SettleAgents = targetUsernames
-	}
-
-	// Save state
-	if err := p.setChannelState(args.ChannelId, state); err != nil {
-		return &model.CommandResponse{
-			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Failed to set settle state.",
+			Text:         "Failed to grant Q&A slots.",
 		}, nil
 	}
 
-	// Schedule automatic restore of previous mode
-	if len(targetUsernames) == 0 {
-		go func() {
-			time.Sleep(time.Duration(seconds) * time.Second)
-			currentState, err := p.getChannelState(args.ChannelId)
-			if err == nil && currentState.SettleUntil > 0 {
-				// Restore previous mode
-				currentState.Mode = currentState.PreviousMode
-				currentState.SettleUntil = 0
-				currentState.SettleAgents = []string{}
-				p.setChannelState(args.ChannelId, currentState)
-			}
-		}()
-	}
-
-	// Build response message
-	issuer, _ := p.API.GetUser(args.UserId)
-	issuerUsername := "Someone"
-	if issuer != nil {
-		issuerUsername = issuer.Username
-	}
-
-	var text string
-	if len(targetUsernames) == 0 {
-		text = fmt.Sprintf("%s has settled the channel for %d seconds", issuerUsername, seconds)
-	} else if len(targetUsernames) == 1 {
-		text = fmt.Sprintf("%s has settled @%s for %d seconds", issuerUsername, targetUsernames[0], seconds)
-	} else {
-		text = fmt.Sprintf("%s has settled @%s for %d seconds", issuerUsername, strings.Join(targetUsernames, ", @"), seconds)
+	slotText := "slot"
+	if slots > 1 {
+		slotText = "slots"
 	}
 
 	return &model.CommandResponse{
 		ResponseType: model.CommandResponseTypeInChannel,
-		Text:         text,
-	}, nil
-}
-
-func (p *Plugin) executeSettleStatus(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
-	state, appErr := p.getChannelState(args.ChannelId)
-	if appErr != nil {
-		return &model.CommandResponse{
-			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Failed to get channel state.",
-		}, nil
-	}
-
-	now := model.GetMillis()
-
-	// Check if settle is active
-	if state.SettleUntil == 0 || now >= state.SettleUntil {
-		return &model.CommandResponse{
-			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "Channel is not currently settled.",
-		}, nil
-	}
-
-	// Calculate remaining time
-	remainingMs := state.SettleUntil - now
-	remainingSeconds := int(remainingMs / 1000)
-
-	var text string
-	if len(state.SettleAgents) == 1 && state.SettleAgents[0] == "all" {
-		text = fmt.Sprintf("Channel settled for %d more seconds (all agents)", remainingSeconds)
-	} else if len(state.SettleAgents) == 1 {
-		text = fmt.Sprintf("@%s settled for %d more seconds", state.SettleAgents[0], remainingSeconds)
-	} else {
-		text = fmt.Sprintf("@%s settled for %d more seconds", strings.Join(state.SettleAgents, ", @"), remainingSeconds)
-	}
-
-	return &model.CommandResponse{
-		ResponseType: model.CommandResponseTypeEphemeral,
-		Text:         text,
+		Text:         fmt.Sprintf("%s granted %d Q&A %s.", withVerb(targets.mentions(), len(targets.users)), slots, slotText),
 	}, nil
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelCommandsRequireModerator(t *testing.T) {
+	for _, command := range []string{
+		"grant @alice",
+		"revoke @alice",
+		"revoke --all",
+		"mode locked",
+		"qa-grant @alice 2",
+	} {
+		t.Run(command, func(t *testing.T) {
+			p, kv := setupStatePlugin(t)
+			api := p.API.(*plugintest.API)
+			api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(false)
+			api.On("HasPermissionToChannel", mock.Anything, mock.Anything, model.PermissionManageChannelRoles).Return(false)
+			args := &model.CommandArgs{UserId: model.NewId(), ChannelId: model.NewId(), Command: "/stick " + command}
+
+			response, appErr := p.ExecuteCommand(nil, args)
+			require.Nil(t, appErr)
+			assert.Equal(t, model.CommandResponseTypeEphemeral, response.ResponseType)
+			assert.Contains(t, response.Text, "Only administrators")
+			assert.Empty(t, kv.values, "nothing was stored")
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+// MessageWillBeUpdated applies the same suppression and speaking rules to edits as to new
+// posts, so users without speaking rights can't use an earlier post to say something new.
+func (p *Plugin) MessageWillBeUpdated(c *plugin.Context, newPost, oldPost *model.Post) (*model.Post, string) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.API.LogError("Panic in MessageWillBeUpdated", "panic", r)
+		}
+	}()
+
+	if newPost == nil || newPost.IsSystemMessage() || newPost.UserId == p.botUserID {
+		return newPost, ""
+	}
+
+	// The hook doesn't say who is editing, so the rules are applied to the author. Pins,
+	// reactions and prop changes, often made by moderators, leave the message alone and
+	// are never rules-checked.
+	if oldPost != nil && newPost.Message == oldPost.Message {
+		return newPost, ""
+	}
+
+	if phrase := matchSuppressionPhrase(p.getConfiguration(), newPost.Message); phrase != "" {
+		p.API.LogWarn("Rejecting edit with suppressed phrase", "phrase", phrase, "post_id", newPost.Id)
+		return nil, "This edit contains a suppressed phrase."
+	}
+
+	state, appErr := p.getChannelState(newPost.ChannelId)
+	if appErr != nil {
+		p.API.LogError("Failed to get channel state", "error", appErr.Error())
+		return newPost, ""
+	}
+
+	if state.FreezeEdits && state.Mode == ModeLocked {
+		return nil, "This channel is locked and edits are frozen."
+	}
+
+	canBypass, _ := p.canBypassTalkingStick(newPost.UserId, newPost.ChannelId)
+	if reason, _ := p.settleReason(newPost.ChannelId, newPost.UserId, state, canBypass); reason != "" {
+		if reason == plugin.DismissPostError {
+			reason = "This channel is settled. Edits are paused until the settle expires."
+		}
+		return nil, reason
+	}
+
+	if !canBypass {
+		if reason := p.enforceEditMode(newPost, state); reason != "" {
+			return nil, reason
+		}
+	}
+
+	if reason := p.enforceLengthCap(newPost, state, canBypass); reason != "" {
+		return nil, reason
+	}
+
+	return newPost, ""
+}
+
+// enforceEditMode applies the channel's speaking mode to an edit from a user who cannot
+// bypass the talking stick. Editing never spends a Q&A slot: posts made since the Q&A
+// session started already passed the slot check, so only older posts are rejected.
+func (p *Plugin) enforceEditMode(post *model.Post, state *ChannelState) string {
+	switch state.Mode {
+	case ModeSpeakersOnly:
+		if p.isSpeaker(state, post.UserId) {
+			return ""
+		}
+		return "This channel is in speakers-only mode. You do not have speaking privileges to edit posts."
+
+	case ModeQA:
+		if p.isSpeaker(state, post.UserId) || post.CreateAt >= state.QASessionStart {
+			return ""
+		}
+		return "This channel is in Q&A mode. Posts from before the session started can't be edited."
+
+	case ModeLocked:
+		return "This channel is locked. Only administrators can edit posts."
+
+	default:
+		return ""
+	}
+}
+
+func (p *Plugin) executeFreezeEdits(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	if response := p.requireModerator(args, "Only administrators can freeze edits."); response != nil {
+		return response, nil
+	}
+
+	if len(params) != 1 || (params[0] != "on" && params[0] != "off") {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Usage: `/stick freeze-edits [on|off]`",
+		}, nil
+	}
+	freeze := params[0] == "on"
+
+	if _, err := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		if state.FreezeEdits == freeze {
+			return false
+		}
+		state.FreezeEdits = freeze
+		return true
+	}); err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to update edit settings.",
+		}, nil
+	}
+
+	text := "Edits are no longer frozen while this channel is locked."
+	if freeze {
+		text = "Edits are now frozen for everyone while this channel is locked."
+	}
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         text,
+	}, nil
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// exportFormatVersion is bumped whenever ChannelExport changes incompatibly.
+// Version 2 replaced the absolute grant expiry with the time left.
+const exportFormatVersion = 2
+
+// maxImportSize bounds the size of an imported file or request body.
+const maxImportSize = 1 << 20
+
+// ChannelExport is the portable form of a channel's talking stick setup. Users and
+// groups are referenced by name rather than ID so exports work across servers.
+type ChannelExport struct {
+	FormatVersion      int                     `json:"format_version"`
+	ExportedAt         int64                   `json:"exported_at"` // Unix timestamp in milliseconds
+	Mode               ChannelMode             `json:"mode"`
+	Speakers           []ExportedGrant         `json:"speakers"`
+	SpeakerGroups      []ExportedGrant         `json:"speaker_groups"`
+	QASlots            map[string]int          `json:"qa_slots"` // Keyed by username
+	QAPolicy           QAPolicy                `json:"qa_policy"`
+	SlowMode           SlowMode                `json:"slow_mode"`
+	LengthCaps         LengthCaps              `json:"length_caps"`
+	FreezeEdits        bool                    `json:"freeze_edits"`
+	BypassOverrides    BypassOverrides         `json:"bypass_overrides"`
+	BypassUsers        map[string]bool         `json:"bypass_users"` // Keyed by username, true always and false never bypasses
+	SettleLimits       SettleLimits            `json:"settle_limits"`
+	Budgets            map[string]*AgentBudget `json:"budgets"` // Keyed by username
+	SuppressionPhrases []string                `json:"suppression_phrases"`
+}
+
+// ExportedGrant is a speaker grant keyed by username or group name. Time-limited grants
+// carry the time they had left, so an export imported later still gets the full remainder.
+type ExportedGrant struct {
+	Name      string `json:"name"`
+	ExpiresIn int64  `json:"expires_in,omitempty"` // Seconds left when exported, 0 never expires
+}
+
+// exportedGrantExpiry converts an absolute expiry into seconds left at now, rounding up so a
+// grant that is still active never exports as permanent.
+func exportedGrantExpiry(grant *SpeakerGrant, now int64) int64 {
+	if grant.ExpiresAt == 0 {
+		return 0
+	}
+	return (grant.ExpiresAt - now + 999) / 1000
+}
+
+func (p *Plugin) buildExport(state *ChannelState) *ChannelExport {
+	now := model.GetMillis()
+
+	export := &ChannelExport{
+		FormatVersion:   exportFormatVersion,
+		ExportedAt:      now,
+		Mode:            state.Mode,
+		Speakers:        []ExportedGrant{},
+		SpeakerGroups:   []ExportedGrant{},
+		QASlots:         make(map[string]int),
+		QAPolicy:        state.QAPolicy,
+		SlowMode:        state.SlowMode,
+		LengthCaps:      state.LengthCaps,
+		FreezeEdits:     state.FreezeEdits,
+		BypassOverrides: state.BypassOverrides,
+		Budgets:         make(map[string]*AgentBudget),
+		BypassUsers:     make(map[string]bool),
+		SettleLimits:    state.SettleLimits,
+	}
+
+	for userID, grant := range state.Speakers {
+		if !grant.active(now) {
+			continue
+		}
+		if user, err := p.API.GetUser(userID); err == nil && user != nil {
+			export.Speakers = append(export.Speakers, ExportedGrant{Name: user.Username, ExpiresIn: exportedGrantExpiry(grant, now)})
+		}
+	}
+	for groupID, grant := range state.SpeakerGroups {
+		if !grant.active(now) {
+			continue
+		}
+		if group, err := p.API.GetGroup(groupID); err == nil && group != nil && group.Name != nil {
+			export.SpeakerGroups = append(export.SpeakerGroups, ExportedGrant{Name: *group.Name, ExpiresIn: exportedGrantExpiry(grant, now)})
+		}
+	}
+	sort.Slice(export.Speakers, func(i, j int) bool { return export.Speakers[i].Name < export.Speakers[j].Name })
+	sort.Slice(export.SpeakerGroups, func(i, j int) bool { return export.SpeakerGroups[i].Name < export.SpeakerGroups[j].Name })
+
+	for userID, slots := range state.QASlots {
+		if user, err := p.API.GetUser(userID); err == nil && user != nil {
+			export.QASlots[user.Username] = slots
+		}
+	}
+
+	for userID, budget := range state.Budgets {
+		if user, err := p.API.GetUser(userID); err == nil && user != nil {
+			// Only the limits travel; usage starts fresh on import
+			exported := &AgentBudget{Posts: budget.Posts, Chars: budget.Chars}
+			exported.reset(0)
+			export.Budgets[user.Username] = exported
+		}
+	}
+
+	for userID, allowed := range state.BypassUsers {
+		if user, err := p.API.GetUser(userID); err == nil && user != nil {
+			export.BypassUsers[user.Username] = allowed
+		}
+	}
+
+	for _, phrase := range strings.Split(p.getConfiguration().SuppressionPhrases, "\n") {
+		if phrase = strings.TrimSpace(phrase); phrase != "" {
+			export.SuppressionPhrases = append(export.SuppressionPhrases, phrase)
+		}
+	}
+
+	return export
+}
+
+// applyImport validates export and resolves its names to IDs on this server. It returns
+// a function that applies the import to a channel state, or a list of problems.
+func (p *Plugin) applyImport(export *ChannelExport, importedBy string) (func(state *ChannelState), []string) {
+	var problems []string
+
+	if export.FormatVersion != exportFormatVersion {
+		problems = append(problems, fmt.Sprintf("unsupported format_version %d (expected %d)", export.FormatVersion, exportFormatVersion))
+		return nil, problems
+	}
+
+	switch export.Mode {
+	case ModeOpen, ModeSpeakersOnly, ModeQA, ModeLocked:
+	default:
+		problems = append(problems, fmt.Sprintf("invalid mode %q", export.Mode))
+	}
+
+	if export.QAPolicy.DefaultSlots < 0 || export.QAPolicy.RefillInterval < 0 || export.QAPolicy.SessionCap < 0 {
+		problems = append(problems, "qa_policy values must not be negative")
+	}
+	for _, limit := range []RateLimit{export.SlowMode.Humans, export.SlowMode.Bots} {
+		if limit.Posts < 0 || limit.Interval < 0 {
+			problems = append(problems, "slow_mode values must not be negative")
+			break
+		}
+	}
+	for _, lengthCap := range []LengthCap{export.LengthCaps.Bots, export.LengthCaps.Speakers, export.LengthCaps.Audience} {
+		if lengthCap.MaxChars < 0 || lengthCap.MaxLines < 0 {
+			problems = append(problems, "length_caps values must not be negative")
+			break
+		}
+	}
+	if export.SettleLimits.DefaultSeconds < 0 || export.SettleLimits.MaxSeconds < 0 {
+		problems = append(problems, "settle_limits values must not be negative")
+	}
+	if action := export.LengthCaps.Action; action != "" && action != LengthActionReject && action != LengthActionTruncate {
+		problems = append(problems, fmt.Sprintf("invalid length_caps action %q", action))
+	}
+
+	userID := func(username string) string {
+		user, err := p.API.GetUserByUsername(strings.TrimPrefix(username, "@"))
+		if err != nil || user == nil {
+			problems = append(problems, fmt.Sprintf("user @%s not found", username))
+			return ""
+		}
+		return user.Id
+	}
+
+	now := model.GetMillis()
+	importedGrant := func(exported ExportedGrant) *SpeakerGrant {
+		grant := &SpeakerGrant{GrantedBy: importedBy, GrantedAt: now}
+		if exported.ExpiresIn < 0 {
+			problems = append(problems, fmt.Sprintf("negative expires_in for @%s", exported.Name))
+		} else if exported.ExpiresIn > 0 {
+			grant.ExpiresAt = now + exported.ExpiresIn*1000
+		}
+		return grant
+	}
+
+	speakers := make(map[string]*SpeakerGrant)
+	for _, exported := range export.Speakers {
+		grant := importedGrant(exported)
+		if id := userID(exported.Name); id != "" {
+			speakers[id] = grant
+		}
+	}
+
+	speakerGroups := make(map[string]*SpeakerGrant)
+	for _, exported := range export.SpeakerGroups {
+		grant := importedGrant(exported)
+		group, ok := p.getGroupByName(strings.TrimPrefix(exported.Name, "@"))
+		if !ok {
+			problems = append(problems, fmt.Sprintf("group @%s not found", exported.Name))
+			continue
+		}
+		speakerGroups[group.Id] = grant
+	}
+
+	qaSlots := make(map[string]int)
+	for username, slots := range export.QASlots {
+		if slots < 0 {
+			problems = append(problems, fmt.Sprintf("negative qa_slots for @%s", username))
+			continue
+		}
+		if id := userID(username); id != "" {
+			qaSlots[id] = slots
+		}
+	}
+
+	budgets := make(map[string]*AgentBudget)
+	for username, budget := range export.Budgets {
+		if budget == nil {
+			continue
+		}
+		for _, allowance := range []BudgetAllowance{budget.Posts, budget.Chars} {
+			if allowance.Limit < 0 || (allowance.enabled() && allowance.Period != BudgetPeriodHour && allowance.Period != BudgetPeriodSession) {
+				problems = append(problems, fmt.Sprintf("invalid budget for @%s", username))
+			}
+		}
+		if id := userID(username); id != "" {
+			imported := &AgentBudget{Posts: budget.Posts, Chars: budget.Chars}
+			imported.reset(now)
+			budgets[id] = imported
+		}
+	}
+
+	bypassUsers := make(map[string]bool)
+	for username, allowed := range export.BypassUsers {
+		if id := userID(username); id != "" {
+			bypassUsers[id] = allowed
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, problems
+	}
+
+	return func(state *ChannelState) {
+		if export.Mode == ModeQA && state.Mode != ModeQA {
+			state.startQASession(now)
+		}
+		state.Mode = export.Mode
+		state.Speakers = speakers
+		state.SpeakerGroups = speakerGroups
+		state.QASlots = qaSlots
+		state.QAPolicy = export.QAPolicy
+		state.SlowMode = export.SlowMode
+		state.LengthCaps = export.LengthCaps
+		state.FreezeEdits = export.FreezeEdits
+		state.BypassOverrides = export.BypassOverrides
+		state.BypassUsers = bypassUsers
+		state.SettleLimits = export.SettleLimits
+		state.Budgets = budgets
+	}, nil
+}
+
+// importChannelState validates and applies raw export JSON to the channel.
+func (p *Plugin) importChannelState(channelID, userID string, data []byte) []string {
+	// Unknown fields are rejected so a typo can't silently leave a setting unchanged
+	var export ChannelExport
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&export); err != nil {
+		return []string{fmt.Sprintf("invalid JSON: %s", err.Error())}
+	}
+	if decoder.More() {
+		return []string{"invalid JSON: unexpected data after the export"}
+	}
+
+	apply, problems := p.applyImport(&export, userID)
+	if len(problems) > 0 {
+		return problems
+	}
+
+	sessionStarted := false
+	if _, err := p.updateChannelState(channelID, func(state *ChannelState) bool {
+		sessionStarted = export.Mode == ModeQA && state.Mode != ModeQA
+		apply(state)
+		return true
+	}); err != nil {
+		return []string{"failed to save channel state"}
+	}
+	p.invalidateChannelBypass(channelID) // The import may change the bypass overrides
+	if sessionStarted {
+		p.clearQuestionBoard(channelID)
+	}
+
+	return nil
+}
+
+func (p *Plugin) executeExport(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	// Exports include the server-wide suppression phrases and the bypass lists
+	if response := p.requireModerator(args, "Only administrators can export Talking Stick settings."); response != nil {
+		return response, nil
+	}
+
+	state, appErr := p.getChannelState(args.ChannelId)
+	if appErr != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to get channel state.",
+		}, nil
+	}
+
+	data, err := json.MarshalIndent(p.buildExport(state), "", "  ")
+	if err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to export channel state.",
+		}, nil
+	}
+
+	filename := "talking-stick-export.json"
+	channelName := "this channel"
+	if channel, err := p.API.GetChannel(args.ChannelId); err == nil && channel != nil {
+		filename = fmt.Sprintf("talking-stick-%s.json", channel.Name)
+		channelName = "~" + channel.Name
+	}
+
+	// The file goes to the admin privately, so channel members never see it
+	dm, appErr := p.API.GetDirectChannel(args.UserId, p.botUserID)
+	if appErr != nil {
+		p.API.LogError("Failed to open direct channel for export", "error", appErr.Error())
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to send the export file.",
+		}, nil
+	}
+
+	fileInfo, appErr := p.API.UploadFile(data, dm.Id, filename)
+	if appErr != nil {
+		p.API.LogError("Failed to upload export", "error", appErr.Error())
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to upload the export file.",
+		}, nil
+	}
+
+	if _, appErr := p.API.CreatePost(&model.Post{
+		UserId:    p.botUserID,
+		ChannelId: dm.Id,
+		Message:   fmt.Sprintf("Talking Stick settings exported from %s. Upload this file to another channel and run `/stick import` there to apply them.", channelName),
+		FileIds:   []string{fileInfo.Id},
+	}); appErr != nil {
+		p.API.LogError("Failed to post export", "error", appErr.Error())
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to post the export file.",
+		}, nil
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         "The export has been sent to you in a direct message from @talking-stick.",
+	}, nil
+}
+
+func (p *Plugin) executeImport(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	if response := p.requireModerator(args, "Only administrators can import Talking Stick settings."); response != nil {
+		return response, nil
+	}
+
+	var postID string
+	if len(params) > 0 {
+		// Accept a bare post ID or a permalink ending in one
+		postID = params[0][strings.LastIndex(params[0], "/")+1:]
+	}
+
+	data, errText := p.findImportFile(args.ChannelId, args.UserId, postID)
+	if errText != "" {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         errText,
+		}, nil
+	}
+
+	if problems := p.importChannelState(args.ChannelId, args.UserId, data); len(problems) > 0 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("Import failed:\n- %s", strings.Join(problems, "\n- ")),
+		}, nil
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         "Talking Stick settings have been imported. Suppression phrases are a global setting and were not changed.",
+	}, nil
+}
+
+// findImportFile returns the contents of the JSON file attached to postID, or when
+// postID is empty, of the most recent JSON file the user posted in the channel.
+func (p *Plugin) findImportFile(channelID, userID, postID string) ([]byte, string) {
+	var posts []*model.Post
+
+	if postID != "" {
+		post, appErr := p.API.GetPost(postID)
+		if appErr != nil || post == nil || post.ChannelId != channelID {
+			return nil, "Post not found in this channel."
+		}
+		posts = []*model.Post{post}
+	} else {
+		list, appErr := p.API.GetPostsForChannel(channelID, 0, 50)
+		if appErr != nil {
+			return nil, "Failed to read recent posts."
+		}
+		for _, id := range list.Order {
+			if post := list.Posts[id]; post.UserId == userID && len(post.FileIds) > 0 {
+				posts = append(posts, post)
+			}
+		}
+	}
+
+	for _, post := range posts {
+		for _, fileID := range post.FileIds {
+			info, appErr := p.API.GetFileInfo(fileID)
+			if appErr != nil || info == nil || info.Extension != "json" {
+				continue
+			}
+			if info.Size > maxImportSize {
+				return nil, "The export file is too large."
+			}
+			data, appErr := p.API.GetFile(fileID)
+			if appErr != nil {
+				return nil, "Failed to read the export file."
+			}
+			return data, ""
+		}
+	}
+
+	return nil, "No JSON export file found. Upload the file to this channel first, or pass its post link: `/stick import <post link>`."
+}
+
+func (p *Plugin) serveExport(w http.ResponseWriter, channelID, userID string) {
+	if !p.canModerateChannel(userID, channelID) {
+		http.Error(w, "only administrators can export", http.StatusForbidden)
+		return
+	}
+
+	state, appErr := p.getChannelState(channelID)
+	if appErr != nil {
+		http.Error(w, "failed to get channel state", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(p.buildExport(state)); err != nil {
+		p.API.LogWarn("Failed to write export response", "error", err)
+	}
+}
+
+func (p *Plugin) serveImport(w http.ResponseWriter, r *http.Request, channelID, userID string) {
+	if !p.canModerateChannel(userID, channelID) {
+		http.Error(w, "only administrators can import", http.StatusForbidden)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxImportSize+1))
+	if err != nil || len(data) > maxImportSize {
+		http.Error(w, "request body is too large or unreadable", http.StatusBadRequest)
+		return
+	}
+
+	if problems := p.importChannelState(channelID, userID, data); len(problems) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(map[string][]string{"errors": problems}); err != nil {
+			p.API.LogWarn("Failed to write import response", "error", err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportedGrantsExpireRelativeToTheImport(t *testing.T) {
+	userID := model.NewId()
+	api := &plugintest.API{}
+	api.On("GetUserByUsername", "alice").Return(&model.User{Id: userID, Username: "alice"}, nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	// An hour-long grant exported a day ago still has its hour
+	export := &ChannelExport{
+		FormatVersion: exportFormatVersion,
+		ExportedAt:    model.GetMillis() - 24*60*60*1000,
+		Mode:          ModeSpeakersOnly,
+		Speakers:      []ExportedGrant{{Name: "alice", ExpiresIn: 3600}},
+	}
+
+	before := model.GetMillis()
+	apply, problems := p.applyImport(export, "admin")
+	require.Empty(t, problems)
+
+	state := newChannelState()
+	apply(state)
+	require.Contains(t, state.Speakers, userID)
+	assert.GreaterOrEqual(t, state.Speakers[userID].ExpiresAt, before+3600*1000)
+	assert.True(t, state.Speakers[userID].active(model.GetMillis()))
+
+	export.Speakers[0].ExpiresIn = -1
+	_, problems = p.applyImport(export, "admin")
+	assert.Equal(t, []string{"negative expires_in for @alice"}, problems)
+}
+
+func TestExportedGrantExpiry(t *testing.T) {
+	const now = 1_000_000
+	assert.EqualValues(t, 0, exportedGrantExpiry(&SpeakerGrant{}, now), "permanent")
+	assert.EqualValues(t, 60, exportedGrantExpiry(&SpeakerGrant{ExpiresAt: now + 60_000}, now))
+	assert.EqualValues(t, 1, exportedGrantExpiry(&SpeakerGrant{ExpiresAt: now + 1}, now), "never rounds down to permanent")
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// globalSettleKey stores the server-wide and team-wide settles.
+const globalSettleKey = "global_settle"
+
+// clusterEventReloadGlobalSettle tells other nodes to reload the global settle record.
+const clusterEventReloadGlobalSettle = "reload_global_settle"
+
+// SettleRecord is one emergency settle covering many channels.
+type SettleRecord struct {
+	Until     int64  `json:"until"` // Unix timestamp in milliseconds
+	SettledBy string `json:"settled_by"`
+}
+
+func (r *SettleRecord) active(now int64) bool {
+	return r != nil && now < r.Until
+}
+
+// GlobalSettle holds emergency settles that silence bots across every channel on the
+// server, or every channel in a team, until they expire.
+type GlobalSettle struct {
+	Global *SettleRecord            `json:"global"`
+	Teams  map[string]*SettleRecord `json:"teams"` // Keyed by team ID
+}
+
+// prune drops expired settles.
+func (g *GlobalSettle) prune(now int64) {
+	if !g.Global.active(now) {
+		g.Global = nil
+	}
+	for teamID, record := range g.Teams {
+		if !record.active(now) {
+			delete(g.Teams, teamID)
+		}
+	}
+}
+
+// loadGlobalSettle reads the record from the KV store and caches it on this node.
+func (p *Plugin) loadGlobalSettle() {
+	settle, _, appErr := p.readGlobalSettle()
+	if appErr != nil {
+		p.API.LogError("Failed to load global settle", "error", appErr.Error())
+		return
+	}
+	p.globalSettle.Store(settle)
+}
+
+func (p *Plugin) readGlobalSettle() (*GlobalSettle, []byte, *model.AppError) {
+	data, appErr := p.API.KVGet(globalSettleKey)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+
+	settle := &GlobalSettle{}
+	if data != nil {
+		if err := json.Unmarshal(data, settle); err != nil {
+			return nil, nil, model.NewAppError("readGlobalSettle", "app.plugin.kv_get.app_error", nil, err.Error(), 500)
+		}
+	}
+	if settle.Teams == nil {
+		settle.Teams = make(map[string]*SettleRecord)
+	}
+	return settle, data, nil
+}
+
+// updateGlobalSettle applies mutate to the stored record with compare-and-set,
+// retrying on conflicts, then tells every node to reload it.
+func (p *Plugin) updateGlobalSettle(mutate func(settle *GlobalSettle)) (*GlobalSettle, *model.AppError) {
+	for attempt := 0; attempt < maxStateUpdateAttempts; attempt++ {
+		settle, oldData, appErr := p.readGlobalSettle()
+		if appErr != nil {
+			return nil, appErr
+		}
+
+		settle.prune(model.GetMillis())
+		mutate(settle)
+
+		data, err := json.Marshal(settle)
+		if err != nil {
+			return nil, model.NewAppError("updateGlobalSettle", "app.plugin.marshal.app_error", nil, err.Error(), 500)
+		}
+
+		ok, appErr := p.API.KVCompareAndSet(globalSettleKey, oldData, data)
+		if appErr != nil {
+			return nil, appErr
+		}
+		if !ok {
+			continue
+		}
+
+		p.globalSettle.Store(settle)
+		if err := p.API.PublishPluginClusterEvent(
+			model.PluginClusterEvent{Id: clusterEventReloadGlobalSettle},
+			model.PluginClusterEventSendOptions{SendType: model.PluginClusterEventSendTypeReliable},
+		); err != nil {
+			p.API.LogWarn("Failed to publish global settle reload", "error", err.Error())
+		}
+		return settle, nil
+	}
+
+	return nil, model.NewAppError("updateGlobalSettle", "app.plugin.kv_conflict.app_error", nil, "", 409)
+}
+
+// globalSettleFor returns the emergency settle covering channelID, if any. The channel
+// is only looked up while a team settle is active.
+func (p *Plugin) globalSettleFor(channelID string) (scope string, record *SettleRecord) {
+	settle := p.globalSettle.Load()
+	if settle == nil {
+		return "", nil
+	}
+
+	now := model.GetMillis()
+	if settle.Global.active(now) {
+		return "global", settle.Global
+	}
+	if len(settle.Teams) == 0 {
+		return "", nil
+	}
+
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil || channel == nil || channel.TeamId == "" {
+		return "", nil
+	}
+	if record := settle.Teams[channel.TeamId]; record.active(now) {
+		return "team", record
+	}
+	return "", nil
+}
+
+// executeGlobalSettle handles /settle global and /settle team, each optionally
+// followed by a duration or "off".
+func (p *Plugin) executeGlobalSettle(args *model.CommandArgs, scope string, params []string) (*model.CommandResponse, *model.AppError) {
+	if scope == "global" && !p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem) {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Only system administrators can settle every channel.",
+		}, nil
+	}
+	if scope == "team" && (args.TeamId == "" || !p.API.HasPermissionToTeam(args.UserId, args.TeamId, model.PermissionManageTeam)) {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Only team administrators can settle every channel in the team.",
+		}, nil
+	}
+
+	config := p.getConfiguration()
+	duration, maxDuration := settleLimits(config, &ChannelState{})
+	turnOff := false
+
+	if len(params) > 1 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("Usage: `/settle %s [duration|off]`", scope),
+		}, nil
+	}
+	if len(params) == 1 {
+		if params[0] == "off" {
+			turnOff = true
+		} else {
+			parsed, ok := parseSettleDuration(params[0])
+			if !ok {
+				return invalidSettleDuration(params[0]), nil
+			}
+			if parsed > maxDuration {
+				return &model.CommandResponse{
+					ResponseType: model.CommandResponseTypeEphemeral,
+					Text:         fmt.Sprintf("Settle duration %s is longer than the maximum of %s.", formatSettleDuration(parsed), formatSettleDuration(maxDuration)),
+				}, nil
+			}
+			duration = parsed
+		}
+	}
+
+	record := &SettleRecord{Until: model.GetMillis() + duration.Milliseconds(), SettledBy: args.UserId}
+	if turnOff {
+		record = nil
+	}
+
+	if _, appErr := p.updateGlobalSettle(func(settle *GlobalSettle) {
+		if scope == "global" {
+			settle.Global = record
+		} else if record == nil {
+			delete(settle.Teams, args.TeamId)
+		} else {
+			settle.Teams[args.TeamId] = record
+		}
+	}); appErr != nil {
+		p.API.LogError("Failed to update global settle", "error", appErr.Error())
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to set settle state.",
+		}, nil
+	}
+
+	where := "every channel on the server"
+	if scope == "team" {
+		where = "every channel in this team"
+	}
+
+	text := fmt.Sprintf("%s has settled all bots in %s for %s", p.issuerUsername(args.UserId), where, formatSettleDuration(duration))
+	if turnOff {
+		text = fmt.Sprintf("%s has ended the settle in %s.", p.issuerUsername(args.UserId), where)
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         text,
+	}, nil
+}
+
+// describeGlobalSettle names the emergency settle covering channelID for /settle status.
+func (p *Plugin) describeGlobalSettle(channelID string) string {
+	scope, record := p.globalSettleFor(channelID)
+	if record == nil {
+		return ""
+	}
+
+	remaining := time.Duration(record.Until-model.GetMillis()) * time.Millisecond
+	where := "server-wide"
+	if scope == "team" {
+		where = "team-wide"
+	}
+	return fmt.Sprintf("All bots are settled %s for %d more seconds", where, int(remaining.Round(time.Second)/time.Second))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// SpeakerGrant records who granted speaking privileges, when, and until when.
+type SpeakerGrant struct {
+	GrantedBy string `json:"granted_by"`
+	GrantedAt int64  `json:"granted_at"` // Unix timestamp in milliseconds
+	ExpiresAt int64  `json:"expires_at"` // Unix timestamp in milliseconds, 0 never expires
+}
+
+// active reports whether the grant is still in effect at now.
+func (g *SpeakerGrant) active(now int64) bool {
+	return g != nil && (g.ExpiresAt == 0 || now < g.ExpiresAt)
+}
+
+// describe renders the remaining time for lists, or "" for permanent grants.
+func (g *SpeakerGrant) describe(now int64) string {
+	if g.ExpiresAt == 0 {
+		return ""
+	}
+	remaining := time.Duration(g.ExpiresAt-now) * time.Millisecond
+	return fmt.Sprintf(" (expires in %s)", remaining.Round(time.Second))
+}
+
+// pruneExpiredGrants removes expired user and group grants from the state and
+// returns the IDs of the users and groups that were removed.
+func (s *ChannelState) pruneExpiredGrants(now int64) (users []string, groups []string) {
+	for userID, grant := range s.Speakers {
+		if !grant.active(now) {
+			delete(s.Speakers, userID)
+			users = append(users, userID)
+		}
+	}
+	for groupID, grant := range s.SpeakerGroups {
+		if !grant.active(now) {
+			delete(s.SpeakerGroups, groupID)
+			groups = append(groups, groupID)
+		}
+	}
+	return users, groups
+}
+
+// sweepExpiredGrants removes expired grants, settles that have run out and old settle
+// strikes from every channel. It runs as a cluster-wide scheduled job, so only one node sweeps at a time.
+func (p *Plugin) sweepExpiredGrants() {
+	now := model.GetMillis()
+
+	channelIDs, appErr := p.listStateChannelIDs()
+	if appErr != nil {
+		p.API.LogError("Failed to list channels for grant sweep", "error", appErr.Error())
+		return
+	}
+
+	for _, channelID := range channelIDs {
+		var expiredUsers, expiredGroups []string
+		var settleCleared bool
+		if _, err := p.updateChannelState(channelID, func(state *ChannelState) bool {
+			expiredUsers, expiredGroups = state.pruneExpiredGrants(now)
+			settleCleared = state.clearExpiredSettle(now)
+			strikesPruned := state.pruneStrikes(now)
+			return len(expiredUsers) > 0 || len(expiredGroups) > 0 || settleCleared || strikesPruned
+		}); err != nil {
+			p.API.LogError("Failed to remove expired grants", "channel_id", channelID, "error", err.Error())
+			continue
+		}
+
+		if settleCleared {
+			p.releaseHeldPosts(channelID)
+		}
+
+		if len(expiredUsers) == 0 && len(expiredGroups) == 0 {
+			continue
+		}
+		if p.getConfiguration().AnnounceExpiredGrants {
+			p.postAnnouncement(channelID, fmt.Sprintf("Speaking privileges have expired for %s.", p.describeGrantees(expiredUsers, expiredGroups)))
+		}
+	}
+}
+
+// listStateChannelIDs returns every channel that has stored talking stick state.
+func (p *Plugin) listStateChannelIDs() ([]string, *model.AppError) {
+	const perPage = 1000
+
+	var channelIDs []string
+	for page := 0; ; page++ {
+		keys, appErr := p.API.KVList(page, perPage)
+		if appErr != nil {
+			return nil, appErr
+		}
+
+		for _, key := range keys {
+			if channelID, ok := strings.CutPrefix(key, "channel_"); ok {
+				channelIDs = append(channelIDs, channelID)
+			}
+		}
+
+		if len(keys) < perPage {
+			return channelIDs, nil
+		}
+	}
+}
+
+// describeGrantees lists users and groups by name for announcements.
+func (p *Plugin) describeGrantees(userIDs []string, groupIDs []string) string {
+	var names []string
+	for _, userID := range userIDs {
+		if user, err := p.API.GetUser(userID); err == nil && user != nil {
+			names = append(names, "@"+user.Username)
+		}
+	}
+	for _, groupID := range groupIDs {
+		if group, err := p.API.GetGroup(groupID); err == nil && group != nil && group.Name != nil {
+			names = append(names, "group @"+*group.Name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// groupMembershipTTL bounds how long a user's group memberships are trusted before
+// they are looked up again, so group changes reach granted speakers without re-granting.
+const groupMembershipTTL = 30 * time.Second
+
+type groupMembershipEntry struct {
+	groupIDs map[string]bool
+	expires  time.Time
+}
+
+// groupMembershipCache remembers which groups each user belongs to.
+type groupMembershipCache struct {
+	mu      sync.Mutex
+	entries map[string]groupMembershipEntry
+}
+
+func newGroupMembershipCache() *groupMembershipCache {
+	return &groupMembershipCache{entries: make(map[string]groupMembershipEntry)}
+}
+
+// userGroupIDs returns the IDs of the groups userID is a member of.
+func (p *Plugin) userGroupIDs(userID string) map[string]bool {
+	cache := p.groupMemberships
+
+	cache.mu.Lock()
+	entry, ok := cache.entries[userID]
+	cache.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.groupIDs
+	}
+
+	groups, err := p.API.GetGroupsForUser(userID)
+	if err != nil {
+		p.API.LogWarn("Failed to get groups for user", "user_id", userID, "error", err.Error())
+		return map[string]bool{}
+	}
+
+	groupIDs := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		groupIDs[group.Id] = true
+	}
+
+	cache.mu.Lock()
+	cache.entries[userID] = groupMembershipEntry{groupIDs: groupIDs, expires: time.Now().Add(groupMembershipTTL)}
+	cache.mu.Unlock()
+
+	return groupIDs
+}
+
+// isSpeaker reports whether userID holds speaking privileges in the channel, either
+// directly or through membership of a granted group. Expired grants are ignored even
+// before the sweep removes them.
+func (p *Plugin) isSpeaker(state *ChannelState, userID string) bool {
+	now := model.GetMillis()
+	if state.Speakers[userID].active(now) {
+		return true
+	}
+	if len(state.SpeakerGroups) == 0 {
+		return false
+	}
+
+	for groupID := range p.userGroupIDs(userID) {
+		if state.SpeakerGroups[groupID].active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// getGroupByName looks up a custom or LDAP group by its mention name.
+func (p *Plugin) getGroupByName(name string) (*model.Group, bool) {
+	group, err := p.API.GetGroupByName(name)
+	if err != nil || group == nil || group.DeleteAt != 0 {
+		return nil, false
+	}
+	return group, true
+}
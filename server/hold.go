@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// How held posts are released once a hold-and-release settle ends.
+const (
+	SettleReleaseDigest   = "digest"  // One digest post with every held message
+	SettleReleaseByAuthor = "authors" // One summary post per author
+)
+
+const (
+	// maxHeldPosts bounds the buffer; the oldest posts are dropped beyond it.
+	maxHeldPosts = 200
+
+	// maxHeldMessageRunes shortens each held message in the digest.
+	maxHeldMessageRunes = 1000
+
+	// maxDigestRunes keeps each digest post safely under the server's post size limit.
+	maxDigestRunes = 15000
+)
+
+// HeldPost is a post intercepted during a hold-and-release settle.
+type HeldPost struct {
+	UserID   string `json:"user_id"`
+	Message  string `json:"message"`
+	CreateAt int64  `json:"create_at"` // Unix timestamp in milliseconds
+}
+
+// HeldPosts is the buffer of posts held in a channel, stored in KV as held_<channel>.
+type HeldPosts struct {
+	Release string     `json:"release"` // SettleReleaseDigest or SettleReleaseByAuthor
+	Posts   []HeldPost `json:"posts"`
+	Dropped int        `json:"dropped"` // Posts discarded once the buffer was full
+}
+
+func heldPostsKey(channelID string) string {
+	return "held_" + channelID
+}
+
+// holdPost adds a settled post to the channel's buffer instead of dropping it.
+func (p *Plugin) holdPost(post *model.Post, release string) {
+	key := heldPostsKey(post.ChannelId)
+
+	for attempt := 0; attempt < maxStateUpdateAttempts; attempt++ {
+		oldData, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			p.API.LogError("Failed to get held posts", "channel_id", post.ChannelId, "error", appErr.Error())
+			return
+		}
+
+		held := &HeldPosts{}
+		if oldData != nil {
+			if err := json.Unmarshal(oldData, held); err != nil {
+				p.API.LogError("Failed to decode held posts", "channel_id", post.ChannelId, "error", err.Error())
+				return
+			}
+		}
+
+		held.Release = release
+		held.Posts = append(held.Posts, HeldPost{UserID: post.UserId, Message: post.Message, CreateAt: model.GetMillis()})
+		if over := len(held.Posts) - maxHeldPosts; over > 0 {
+			held.Posts = held.Posts[over:]
+			held.Dropped += over
+		}
+
+		data, err := json.Marshal(held)
+		if err != nil {
+			p.API.LogError("Failed to encode held posts", "channel_id", post.ChannelId, "error", err.Error())
+			return
+		}
+
+		ok, appErr := p.API.KVCompareAndSet(key, oldData, data)
+		if appErr != nil {
+			p.API.LogError("Failed to store held post", "channel_id", post.ChannelId, "error", appErr.Error())
+			return
+		}
+		if ok {
+			return
+		}
+	}
+
+	p.API.LogWarn("Gave up holding post after repeated conflicts", "channel_id", post.ChannelId)
+}
+
+// scheduleHeldRelease releases the channel's held posts shortly after until. The
+// scheduled sweep of expired settles releases them too, in case this node restarts first.
+func (p *Plugin) scheduleHeldRelease(channelID string, until int64) {
+	delay := time.Duration(until-model.GetMillis())*time.Millisecond + time.Second
+	time.AfterFunc(delay, func() { p.releaseHeldPosts(channelID) })
+}
+
+// releaseHeldPosts posts the channel's held messages once no settle is active. Taking
+// the buffer is a compare-and-delete, so only one caller releases each batch.
+func (p *Plugin) releaseHeldPosts(channelID string) {
+	state, appErr := p.getChannelState(channelID)
+	if appErr != nil {
+		p.API.LogError("Failed to get channel state for release", "channel_id", channelID, "error", appErr.Error())
+		return
+	}
+	if state.settleActive(model.GetMillis()) {
+		return // Extended or settled again; released when that ends
+	}
+
+	key := heldPostsKey(channelID)
+	data, appErr := p.API.KVGet(key)
+	if appErr != nil || data == nil {
+		return
+	}
+	if ok, appErr := p.API.KVCompareAndDelete(key, data); appErr != nil || !ok {
+		return
+	}
+
+	held := &HeldPosts{}
+	if err := json.Unmarshal(data, held); err != nil {
+		p.API.LogError("Failed to decode held posts", "channel_id", channelID, "error", err.Error())
+		return
+	}
+	if len(held.Posts) == 0 {
+		return
+	}
+
+	usernames := make(map[string]string)
+	username := func(userID string) string {
+		if name, ok := usernames[userID]; ok {
+			return name
+		}
+		name := "unknown"
+		if user, err := p.API.GetUser(userID); err == nil && user != nil {
+			name = user.Username
+		}
+		usernames[userID] = name
+		return name
+	}
+
+	var groups [][]HeldPost
+	if held.Release == SettleReleaseByAuthor {
+		byAuthor := make(map[string][]HeldPost)
+		var authors []string
+		for _, post := range held.Posts {
+			if _, ok := byAuthor[post.UserID]; !ok {
+				authors = append(authors, post.UserID)
+			}
+			byAuthor[post.UserID] = append(byAuthor[post.UserID], post)
+		}
+		sort.SliceStable(authors, func(i, j int) bool { return username(authors[i]) < username(authors[j]) })
+		for _, author := range authors {
+			groups = append(groups, byAuthor[author])
+		}
+	} else {
+		groups = [][]HeldPost{held.Posts}
+	}
+
+	for i, posts := range groups {
+		header := fmt.Sprintf("#### Held during settle (%d %s)", len(posts), pluralize(len(posts), "post", "posts"))
+		if held.Release == SettleReleaseByAuthor {
+			header = fmt.Sprintf("#### Held from @%s during settle (%d %s)", username(posts[0].UserID), len(posts), pluralize(len(posts), "post", "posts"))
+		}
+		if i == 0 && held.Dropped > 0 {
+			header += fmt.Sprintf("\n_%d older %s did not fit and were dropped._", held.Dropped, pluralize(held.Dropped, "post", "posts"))
+		}
+
+		var entries []string
+		for _, post := range posts {
+			entries = append(entries, formatHeldPost(post, username(post.UserID), held.Release == SettleReleaseByAuthor))
+		}
+		for _, chunk := range chunkDigest(header, entries) {
+			p.postAnnouncement(channelID, chunk)
+		}
+	}
+}
+
+// formatHeldPost renders one held message as a quoted digest entry.
+func formatHeldPost(post HeldPost, username string, omitAuthor bool) string {
+	message := post.Message
+	if runes := []rune(message); len(runes) > maxHeldMessageRunes {
+		message = string(runes[:maxHeldMessageRunes]) + TruncationMarker
+	}
+
+	at := time.UnixMilli(post.CreateAt).UTC().Format("15:04:05 UTC")
+	heading := fmt.Sprintf("**@%s** at %s:", username, at)
+	if omitAuthor {
+		heading = fmt.Sprintf("**%s:**", at)
+	}
+	return heading + "\n> " + strings.ReplaceAll(message, "\n", "\n> ")
+}
+
+// chunkDigest joins entries under header, splitting into several posts when needed.
+func chunkDigest(header string, entries []string) []string {
+	var chunks []string
+	current := header
+	for _, entry := range entries {
+		if len([]rune(current))+len([]rune(entry))+2 > maxDigestRunes {
+			chunks = append(chunks, current)
+			current = header + " (continued)"
+		}
+		current += "\n\n" + entry
+	}
+	return append(chunks, current)
+}
+
+func pluralize(count int, singular, plural string) string {
+	if count == 1 {
+		return singular
+	}
+	return plural
+}
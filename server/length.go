@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// TruncationMarker is appended to messages shortened by a length cap.
+const TruncationMarker = "…(truncated)"
+
+// shortTruncationMarker replaces TruncationMarker under caps too small to fit it with any text.
+const shortTruncationMarker = "…"
+
+const (
+	LengthActionReject   = "reject"
+	LengthActionTruncate = "truncate"
+)
+
+// LengthCap limits the size of a single message. Zero values mean no limit.
+type LengthCap struct {
+	MaxChars int `json:"max_chars"`
+	MaxLines int `json:"max_lines"`
+}
+
+func (c LengthCap) enabled() bool {
+	return c.MaxChars > 0 || c.MaxLines > 0
+}
+
+func (c LengthCap) String() string {
+	if !c.enabled() {
+		return "no limit"
+	}
+
+	var parts []string
+	if c.MaxChars > 0 {
+		parts = append(parts, fmt.Sprintf("%d characters", c.MaxChars))
+	}
+	if c.MaxLines > 0 {
+		parts = append(parts, fmt.Sprintf("%d lines", c.MaxLines))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// LengthCaps holds per-role message length limits for a channel.
+type LengthCaps struct {
+	Bots     LengthCap `json:"bots"`
+	Speakers LengthCap `json:"speakers"`
+	Audience LengthCap `json:"audience"`
+	Action   string    `json:"action"` // LengthActionReject (default) or LengthActionTruncate
+}
+
+func (c LengthCaps) enabled() bool {
+	return c.Bots.enabled() || c.Speakers.enabled() || c.Audience.enabled()
+}
+
+// lengthCapFor returns the cap for the post's author. Bots are always capped, while humans
+// who can bypass the talking stick are not.
+func (p *Plugin) lengthCapFor(userID string, state *ChannelState, canBypass bool) LengthCap {
+	if !state.LengthCaps.enabled() {
+		return LengthCap{}
+	}
+	if p.isBotUser(userID) {
+		return state.LengthCaps.Bots
+	}
+	if canBypass {
+		return LengthCap{}
+	}
+	if p.isSpeaker(state, userID) {
+		return state.LengthCaps.Speakers
+	}
+	return state.LengthCaps.Audience
+}
+
+// enforceLengthCap applies the author's length cap to the post, truncating it in place
+// when the channel is set to truncate. It returns a rejection reason or "".
+func (p *Plugin) enforceLengthCap(post *model.Post, state *ChannelState, canBypass bool) string {
+	lengthCap := p.lengthCapFor(post.UserId, state, canBypass)
+	if !lengthCap.enabled() {
+		return ""
+	}
+
+	lines := strings.Split(post.Message, "\n")
+	runes := []rune(post.Message)
+
+	tooManyLines := lengthCap.MaxLines > 0 && len(lines) > lengthCap.MaxLines
+	tooManyChars := lengthCap.MaxChars > 0 && len(runes) > lengthCap.MaxChars
+	if !tooManyLines && !tooManyChars {
+		return ""
+	}
+
+	if state.LengthCaps.Action != LengthActionTruncate {
+		return fmt.Sprintf("Your message is too long for this channel (limit: %s).", lengthCap)
+	}
+
+	post.Message = truncateMessage(post.Message, lengthCap)
+	return ""
+}
+
+// truncateMessage shortens message to fit within the cap, marker included.
+func truncateMessage(message string, lengthCap LengthCap) string {
+	if lengthCap.MaxLines > 0 {
+		lines := strings.Split(message, "\n")
+		if len(lines) > lengthCap.MaxLines {
+			message = strings.Join(lines[:lengthCap.MaxLines], "\n")
+		}
+	}
+
+	runes := []rune(message)
+	marker := []rune(TruncationMarker)
+	if lengthCap.MaxChars > 0 && len(marker) >= lengthCap.MaxChars {
+		marker = []rune(shortTruncationMarker)
+	}
+	if lengthCap.MaxChars > 0 && len(runes)+len(marker) > lengthCap.MaxChars {
+		runes = runes[:lengthCap.MaxChars-len(marker)]
+	}
+
+	return strings.TrimRight(string(runes), " \n") + string(marker)
+}
+
+func (p *Plugin) executeMaxLength(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	usage := "Usage: `/stick maxlength [bots|speakers|audience] <count> <chars|lines>`, `/stick maxlength [bots|speakers|audience] off` or `/stick maxlength action [reject|truncate]`"
+
+	if len(params) == 0 {
+		state, err := p.getChannelState(args.ChannelId)
+		if err != nil {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         "Failed to get channel state.",
+			}, nil
+		}
+
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("### Message Length Caps\n\n%s", describeLengthCaps(state.LengthCaps)),
+		}, nil
+	}
+
+	if response := p.requireModerator(args, "Only administrators can change message length caps."); response != nil {
+		return response, nil
+	}
+
+	if len(params) < 2 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         usage,
+		}, nil
+	}
+
+	var apply func(caps *LengthCaps)
+
+	if params[0] == "action" {
+		action := params[1]
+		if action != LengthActionReject && action != LengthActionTruncate {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         usage,
+			}, nil
+		}
+		apply = func(caps *LengthCaps) { caps.Action = action }
+	} else {
+		role := params[0]
+		if role != "bots" && role != "speakers" && role != "audience" {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         usage,
+			}, nil
+		}
+
+		var update func(lengthCap *LengthCap)
+		if params[1] == "off" {
+			update = func(lengthCap *LengthCap) { *lengthCap = LengthCap{} }
+		} else {
+			count, convErr := strconv.Atoi(params[1])
+			if convErr != nil || count < 1 || len(params) < 3 || (params[2] != "chars" && params[2] != "lines") {
+				return &model.CommandResponse{
+					ResponseType: model.CommandResponseTypeEphemeral,
+					Text:         usage,
+				}, nil
+			}
+			if params[2] == "chars" {
+				update = func(lengthCap *LengthCap) { lengthCap.MaxChars = count }
+			} else {
+				update = func(lengthCap *LengthCap) { lengthCap.MaxLines = count }
+			}
+		}
+
+		apply = func(caps *LengthCaps) {
+			switch role {
+			case "bots":
+				update(&caps.Bots)
+			case "speakers":
+				update(&caps.Speakers)
+			case "audience":
+				update(&caps.Audience)
+			}
+		}
+	}
+
+	state, err := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		apply(&state.LengthCaps)
+		return true
+	})
+	if err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to update message length caps.",
+		}, nil
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         fmt.Sprintf("Message length caps updated.\n\n%s", describeLengthCaps(state.LengthCaps)),
+	}, nil
+}
+
+func describeLengthCaps(caps LengthCaps) string {
+	action := "rejected"
+	if caps.Action == LengthActionTruncate {
+		action = "truncated"
+	}
+
+	return fmt.Sprintf("- **Bots:** %s\n- **Speakers:** %s\n- **Audience:** %s\n- Messages over the limit are %s",
+		caps.Bots, caps.Speakers, caps.Audience, action)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateMessage(t *testing.T) {
+	long := strings.Repeat("word ", 20)
+
+	for _, tc := range []struct {
+		name      string
+		message   string
+		lengthCap LengthCap
+		expected  string
+	}{
+		{
+			name:      "chars",
+			message:   long,
+			lengthCap: LengthCap{MaxChars: 22},
+			expected:  "word word" + TruncationMarker,
+		},
+		{
+			name:      "lines",
+			message:   "one\ntwo\nthree",
+			lengthCap: LengthCap{MaxLines: 2},
+			expected:  "one\ntwo" + TruncationMarker,
+		},
+		{
+			name:      "cap no longer than the marker",
+			message:   long,
+			lengthCap: LengthCap{MaxChars: utf8.RuneCountInString(TruncationMarker)},
+			expected:  "word word w" + shortTruncationMarker,
+		},
+		{
+			name:      "cap of one character",
+			message:   long,
+			lengthCap: LengthCap{MaxChars: 1},
+			expected:  shortTruncationMarker,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			truncated := truncateMessage(tc.message, tc.lengthCap)
+			assert.Equal(t, tc.expected, truncated)
+			if tc.lengthCap.MaxChars > 0 {
+				assert.LessOrEqual(t, utf8.RuneCountInString(truncated), tc.lengthCap.MaxChars)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// maxOverviewRows bounds how many channels /stick channels prints.
+const maxOverviewRows = 100
+
+// ChannelSummary describes one channel with talking stick restrictions.
+type ChannelSummary struct {
+	ChannelID   string      `json:"channel_id"`
+	ChannelName string      `json:"channel_name"`
+	DisplayName string      `json:"display_name"`
+	TeamID      string      `json:"team_id"`
+	Mode        ChannelMode `json:"mode"`
+	Speakers    int         `json:"speakers"` // Active user and group grants
+	Settled     bool        `json:"settled"`
+	SettleUntil int64       `json:"settle_until,omitempty"` // Unix timestamp in milliseconds
+}
+
+// listRestrictedChannels summarizes every channel whose state differs from the defaults,
+// optionally limited to one team and one mode.
+func (p *Plugin) listRestrictedChannels(teamID string, mode ChannelMode) ([]ChannelSummary, *model.AppError) {
+	channelIDs, appErr := p.listStateChannelIDs()
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	now := model.GetMillis()
+	summaries := []ChannelSummary{}
+	for _, channelID := range channelIDs {
+		state, appErr := p.getChannelState(channelID)
+		if appErr != nil {
+			p.API.LogWarn("Failed to get channel state for overview", "channel_id", channelID, "error", appErr.Error())
+			continue
+		}
+		if state.isDefault() || (mode != "" && state.Mode != mode) {
+			continue
+		}
+
+		channel, appErr := p.API.GetChannel(channelID)
+		if appErr != nil || channel == nil {
+			continue // Deleted channels are left for the stale user sweep
+		}
+		if teamID != "" && channel.TeamId != teamID {
+			continue
+		}
+
+		summary := ChannelSummary{
+			ChannelID:   channelID,
+			ChannelName: channel.Name,
+			DisplayName: channel.DisplayName,
+			TeamID:      channel.TeamId,
+			Mode:        state.Mode,
+			Settled:     state.settleActive(now),
+		}
+		if summary.Settled {
+			summary.SettleUntil = state.SettleUntil
+		}
+		for _, grant := range state.Speakers {
+			if grant.active(now) {
+				summary.Speakers++
+			}
+		}
+		for _, grant := range state.SpeakerGroups {
+			if grant.active(now) {
+				summary.Speakers++
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].TeamID != summaries[j].TeamID {
+			return summaries[i].TeamID < summaries[j].TeamID
+		}
+		return summaries[i].ChannelName < summaries[j].ChannelName
+	})
+	return summaries, nil
+}
+
+// canViewOverview reports whether userID may list restricted channels in teamID, or
+// across the whole server when teamID is empty.
+func (p *Plugin) canViewOverview(userID, teamID string) bool {
+	if p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		return true
+	}
+	return teamID != "" && p.API.HasPermissionToTeam(userID, teamID, model.PermissionManageTeam)
+}
+
+func (p *Plugin) executeChannels(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	usage := "Usage: `/stick channels [open|speakers|qa|locked] [team name]`"
+
+	var mode ChannelMode
+	teamID := ""
+	for _, param := range params {
+		switch ChannelMode(param) {
+		case ModeOpen, ModeSpeakersOnly, ModeQA, ModeLocked:
+			mode = ChannelMode(param)
+			continue
+		}
+
+		team, appErr := p.API.GetTeamByName(param)
+		if appErr != nil || team == nil || teamID != "" {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         usage,
+			}, nil
+		}
+		teamID = team.Id
+	}
+
+	// Team admins see their own team unless they name one
+	if teamID == "" && !p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem) {
+		teamID = args.TeamId
+	}
+	if !p.canViewOverview(args.UserId, teamID) {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Only system and team administrators can list restricted channels.",
+		}, nil
+	}
+
+	summaries, appErr := p.listRestrictedChannels(teamID, mode)
+	if appErr != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to list channels.",
+		}, nil
+	}
+
+	if len(summaries) == 0 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "No channels have Talking Stick restrictions.",
+		}, nil
+	}
+
+	teamNames := make(map[string]string)
+	now := model.GetMillis()
+	rows := []string{"| Channel | Team | Mode | Speakers | Settle |", "|---|---|---|---|---|"}
+	for i, summary := range summaries {
+		if i == maxOverviewRows {
+			rows = append(rows, fmt.Sprintf("\n…and %d more. Narrow the list by mode or team.", len(summaries)-maxOverviewRows))
+			break
+		}
+
+		teamName, ok := teamNames[summary.TeamID]
+		if !ok && summary.TeamID != "" {
+			if team, appErr := p.API.GetTeam(summary.TeamID); appErr == nil && team != nil {
+				teamName = team.Name
+			}
+			teamNames[summary.TeamID] = teamName
+		}
+
+		settle := "-"
+		if summary.Settled {
+			settle = fmt.Sprintf("%ds left", (summary.SettleUntil-now+999)/1000)
+		}
+
+		// Direct and group messages have no team and no useful channel name
+		name := "~" + summary.ChannelName
+		if summary.TeamID == "" && summary.DisplayName != "" {
+			name = summary.DisplayName
+		}
+		rows = append(rows, fmt.Sprintf("| %s | %s | %s | %d | %s |", name, teamName, summary.Mode, summary.Speakers, settle))
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         fmt.Sprintf("### Restricted Channels\n\n%s", strings.Join(rows, "\n")),
+	}, nil
+}
+
+// serveChannels lists restricted channels, filtered by the team_id and mode query parameters.
+func (p *Plugin) serveChannels(w http.ResponseWriter, r *http.Request, userID string) {
+	teamID := r.URL.Query().Get("team_id")
+	mode := ChannelMode(r.URL.Query().Get("mode"))
+
+	switch mode {
+	case "", ModeOpen, ModeSpeakersOnly, ModeQA, ModeLocked:
+	default:
+		http.Error(w, "invalid mode", http.StatusBadRequest)
+		return
+	}
+
+	if !p.canViewOverview(userID, teamID) {
+		http.Error(w, "only system and team administrators can list restricted channels", http.StatusForbidden)
+		return
+	}
+
+	summaries, appErr := p.listRestrictedChannels(teamID, mode)
+	if appErr != nil {
+		http.Error(w, "failed to list channels", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(summaries); err != nil {
+		p.API.LogWarn("Failed to write channels response", "error", err)
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
 )
 
 type Plugin struct {
@@ -15,6 +18,19 @@ type Plugin struct {
 
 	configurationLock sync.RWMutex
 	configuration     *configuration
+
+	jobs []*cluster.Job // Scheduled background sweeps, closed on deactivate
+
+	stateCache  *channelStateCache
+	bypassCache *bypassCache
+	botUsers    sync.Map // userID -> bool
+
+	groupMemberships *groupMembershipCache
+
+	globalSettle atomic.Pointer[GlobalSettle] // Cached copy of the global settle record
+
+	// botUserID is the plugin's own bot, used for announcements
+	botUserID string
 }
 
 type configuration struct {
@@ -23,6 +39,17 @@ type configuration struct {
 	AllowChannelAdmins bool
 	AllowBots          bool
 	SuppressionPhrases string
+
+	AnnounceExpiredGrants bool
+
+	AlwaysBypassUsers string // Usernames, one per line, that bypass everywhere
+	NeverBypassUsers  string // Usernames, one per line, that never bypass
+
+	SettleDefaultSeconds int // Used by /settle without a duration, 0 means 20 seconds
+	SettleMaxSeconds     int // Longest allowed settle, 0 means 5 minutes
+
+	SettleBackoff    string // Escalating durations for repeat settles of an agent, e.g. "20s, 60s, 5m"
+	MuteAfterStrikes int    // Mute an agent settled this many times within an hour, 0 never mutes
 }
 
 type ChannelMode string
@@ -35,23 +62,71 @@ const (
 )
 
 type ChannelState struct {
-	Mode         ChannelMode     `json:"mode"`
-	Speakers     map[string]bool `json:"speakers"`
-	QASlots      map[string]int  `json:"qa_slots"`
-	SettleUntil  int64           `json:"settle_until"`  // Unix timestamp in milliseconds
-	SettleAgents []string        `json:"settle_agents"` // ["all"] or ["username1", "username2"]
-	PreviousMode ChannelMode     `json:"previous_mode"` // Mode to restore after settle expires
+	SchemaVersion int                      `json:"schema_version"` // See currentSchemaVersion and stateMigrations
+	Version       int64                    `json:"version"`        // Incremented on every write, used for compare-and-set
+	Mode          ChannelMode              `json:"mode"`
+	Speakers      map[string]*SpeakerGrant `json:"speakers"`
+	SpeakerGroups map[string]*SpeakerGrant `json:"speaker_groups"` // Keyed by group ID, membership is resolved when posting
+	QASlots       map[string]int           `json:"qa_slots"`
+	SettleUntil   int64                    `json:"settle_until"`  // Unix timestamp in milliseconds
+	SettleScope   string                   `json:"settle_scope"`  // SettleScopeBots, SettleScopeHumans or SettleScopeAll; "" when only agents are settled
+	SettleAgents  []string                 `json:"settle_agents"` // Usernames settled individually
+	SettleLimits  SettleLimits             `json:"settle_limits"`
+	SettleRelease string                   `json:"settle_release"` // SettleReleaseDigest or SettleReleaseByAuthor holds posts, "" drops them
+	Strikes       map[string]*AgentStrikes `json:"strikes"`        // Keyed by user ID
+
+	QAPolicy       QAPolicy         `json:"qa_policy"`
+	QASessionStart int64            `json:"qa_session_start"` // Unix timestamp in milliseconds
+	QAUsed         map[string]int   `json:"qa_used"`          // Questions asked this session
+	QALastRefill   map[string]int64 `json:"qa_last_refill"`   // Last slot refill per user, in milliseconds
+
+	SlowMode SlowMode                `json:"slow_mode"`
+	Budgets  map[string]*AgentBudget `json:"budgets"` // Keyed by user ID
+
+	LengthCaps LengthCaps `json:"length_caps"`
+
+	FreezeEdits bool `json:"freeze_edits"` // Reject every edit while the channel is locked
+
+	BypassOverrides BypassOverrides `json:"bypass_overrides"`
+	BypassUsers     map[string]bool `json:"bypass_users"` // User ID -> always (true) or never (false) bypasses
 }
 
 func (p *Plugin) OnActivate() error {
 	p.API.LogInfo("==== TALKING STICK PLUGIN ACTIVATING v0.2.6 ====")
+	p.stateCache = newChannelStateCache(stateCacheSize, stateCacheTTL)
+	p.bypassCache = newBypassCache()
+	p.groupMemberships = newGroupMembershipCache()
+
+	botUserID, err := p.API.EnsureBotUser(&model.Bot{
+		Username:    "talking-stick",
+		DisplayName: "Talking Stick",
+		Description: "Announces automatic Talking Stick moderation actions.",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to ensure bot user: %w", err)
+	}
+	p.botUserID = botUserID
+
+	grantSweep, err := cluster.Schedule(p.API, "grant_sweep", cluster.MakeWaitForInterval(time.Minute), p.sweepExpiredGrants)
+	if err != nil {
+		return fmt.Errorf("failed to schedule grant sweep: %w", err)
+	}
+	staleSweep, err := cluster.Schedule(p.API, "stale_user_sweep", cluster.MakeWaitForInterval(time.Hour), p.sweepStaleUsers)
+	if err != nil {
+		return fmt.Errorf("failed to schedule stale user sweep: %w", err)
+	}
+	p.jobs = []*cluster.Job{grantSweep, staleSweep}
+
+	p.loadGlobalSettle()
+	go p.migrateAllChannelStates()
+
 	stickCommand := &model.Command{
 		Trigger:          "stick",
 		DisplayName:      "Talking Stick",
 		Description:      "Manage speaking permissions in channels",
 		AutoComplete:     true,
 		AutoCompleteDesc: "Manage channel moderation and speaking privileges",
-		AutoCompleteHint: "[grant|revoke|list|mode|qa-grant|help]",
+		AutoCompleteHint: "[grant|revoke|reset|list|channels|export|import|mode|budget|slowmode|maxlength|freeze-edits|bypass|qa-grant|qa-policy|ask|questions|answered|help]",
 	}
 
 	if err := p.API.RegisterCommand(stickCommand); err != nil {
@@ -64,7 +139,7 @@ func (p *Plugin) OnActivate() error {
 		Description:      "Temporarily suppress agent responses (circuit breaker for doom loops)",
 		AutoComplete:     true,
 		AutoCompleteDesc: "Temporarily quiet agent responses in channel",
-		AutoCompleteHint: "[seconds] [@agent1 @agent2...] or 'status'",
+		AutoCompleteHint: "[bots|humans|all] [seconds] [@agent1 @agent2...], +seconds, off, purge, unmute, limits, team, global or status",
 	}
 
 	if err := p.API.RegisterCommand(settleCommand); err != nil {
@@ -75,6 +150,15 @@ func (p *Plugin) OnActivate() error {
 	return nil
 }
 
+func (p *Plugin) OnDeactivate() error {
+	for _, job := range p.jobs {
+		if err := job.Close(); err != nil {
+			p.API.LogWarn("Failed to stop scheduled job", "error", err.Error())
+		}
+	}
+	return nil
+}
+
 func (p *Plugin) getConfiguration() *configuration {
 	p.configurationLock.RLock()
 	defer p.configurationLock.RUnlock()
@@ -102,69 +186,227 @@ func (p *Plugin) OnConfigurationChange() error {
 	p.configuration = configuration
 	p.configurationLock.Unlock()
 
+	// Bypass decisions depend on the Allow* settings
+	if p.bypassCache != nil {
+		p.bypassCache.clear()
+	}
+
 	return nil
 }
 
-func (p *Plugin) getChannelState(channelID string) (*ChannelState, *model.AppError) {
-	key := fmt.Sprintf("channel_%s", channelID)
-	data, err := p.API.KVGet(key)
-	if err != nil {
-		return nil, model.NewAppError("getChannelState", "app.plugin.kv_get.app_error", nil, "", 500)
+func newChannelState() *ChannelState {
+	state := &ChannelState{
+		SchemaVersion: currentSchemaVersion,
+		Mode:          ModeOpen,
 	}
+	state.ensureMaps()
+	return state
+}
 
-	if data == nil {
-		return &ChannelState{
-			Mode:     ModeOpen,
-			Speakers: make(map[string]bool),
-			QASlots:  make(map[string]int),
-		}, nil
+// ensureMaps fills in collections that are absent from stored state, so callers can
+// always write to them.
+func (s *ChannelState) ensureMaps() {
+	if s.Speakers == nil {
+		s.Speakers = make(map[string]*SpeakerGrant)
+	}
+	if s.SpeakerGroups == nil {
+		s.SpeakerGroups = make(map[string]*SpeakerGrant)
+	}
+	if s.QASlots == nil {
+		s.QASlots = make(map[string]int)
+	}
+	if s.SettleAgents == nil {
+		s.SettleAgents = []string{}
+	}
+	if s.QAUsed == nil {
+		s.QAUsed = make(map[string]int)
+	}
+	if s.QALastRefill == nil {
+		s.QALastRefill = make(map[string]int64)
 	}
+	if s.Budgets == nil {
+		s.Budgets = make(map[string]*AgentBudget)
+	}
+	if s.BypassUsers == nil {
+		s.BypassUsers = make(map[string]bool)
+	}
+	if s.Strikes == nil {
+		s.Strikes = make(map[string]*AgentStrikes)
+	}
+}
 
-	var state ChannelState
-	if err := json.Unmarshal(data, &state); err != nil {
-		return nil, model.NewAppError("getChannelState", "app.plugin.unmarshal.app_error", nil, "", 500)
+// maxStateUpdateAttempts bounds the compare-and-set retry loop in updateChannelState.
+const maxStateUpdateAttempts = 10
+
+func (p *Plugin) getChannelState(channelID string) (*ChannelState, *model.AppError) {
+	state, _, err := p.loadChannelState(channelID)
+	return state, err
+}
+
+// loadChannelState returns the channel state together with the raw bytes it was
+// decoded from, which are nil when the channel has no stored state. Reads are
+// served from the node-local cache when possible.
+func (p *Plugin) loadChannelState(channelID string) (*ChannelState, []byte, *model.AppError) {
+	data, cached := p.stateCache.get(channelID)
+	if !cached {
+		gen := p.stateCache.currentGeneration()
+		key := fmt.Sprintf("channel_%s", channelID)
+		var err *model.AppError
+		data, err = p.API.KVGet(key)
+		if err != nil {
+			return nil, nil, model.NewAppError("getChannelState", "app.plugin.kv_get.app_error", nil, "", 500)
+		}
+		p.stateCache.set(channelID, data, gen)
 	}
 
-	if state.Speakers == nil {
-		state.Speakers = make(map[string]bool)
+	if data == nil {
+		return newChannelState(), nil, nil
 	}
-	if state.QASlots == nil {
-		state.QASlots = make(map[string]int)
+
+	migrated, err := migrateStateData(data)
+	if err != nil {
+		p.API.LogError("Failed to migrate channel state", "channel_id", channelID, "error", err.Error())
+		return nil, nil, model.NewAppError("getChannelState", "app.plugin.migrate.app_error", nil, "", 500)
 	}
-	if state.SettleAgents == nil {
-		state.SettleAgents = []string{}
+
+	var state ChannelState
+	if err := json.Unmarshal(migrated, &state); err != nil {
+		return nil, nil, model.NewAppError("getChannelState", "app.plugin.unmarshal.app_error", nil, "", 500)
 	}
+	state.ensureMaps()
 
-	return &state, nil
+	return &state, data, nil
 }
 
-func (p *Plugin) setChannelState(channelID string, state *ChannelState) *model.AppError {
+// compareAndSetChannelState writes state only if the stored value is still oldData,
+// the raw bytes state was loaded from. It returns a 409 error on conflict; use
+// updateChannelState to retry automatically.
+func (p *Plugin) compareAndSetChannelState(channelID string, oldData []byte, state *ChannelState) *model.AppError {
+	if state.isDefault() {
+		if appErr := p.deleteChannelState(channelID, oldData); appErr != nil {
+			return appErr
+		}
+		state.Version = 0
+		return nil
+	}
+
 	key := fmt.Sprintf("channel_%s", channelID)
-	data, err := json.Marshal(state)
+
+	next := *state
+	next.Version++
+	data, err := json.Marshal(&next)
 	if err != nil {
 		return model.NewAppError("setChannelState", "app.plugin.marshal.app_error", nil, "", 500)
 	}
 
-	if err := p.API.KVSet(key, data); err != nil {
+	gen := p.stateCache.currentGeneration()
+	ok, appErr := p.API.KVCompareAndSet(key, oldData, data)
+	if appErr != nil {
+		p.stateCache.remove(channelID)
 		return model.NewAppError("setChannelState", "app.plugin.kv_set.app_error", nil, "", 500)
 	}
+	if !ok {
+		// Our view was stale, possibly from the cache - make the retry read the KV store
+		p.stateCache.remove(channelID)
+		return model.NewAppError("setChannelState", "app.plugin.kv_conflict.app_error", nil, "", 409)
+	}
+
+	p.stateCache.set(channelID, data, gen)
+	p.publishStateInvalidation(channelID)
+
+	state.Version = next.Version
 	return nil
 }
 
+// updateChannelState applies mutate to the latest stored state and saves it with
+// compare-and-set, re-reading and re-applying mutate whenever a concurrent writer
+// got there first. If mutate returns false nothing is written.
+func (p *Plugin) updateChannelState(channelID string, mutate func(state *ChannelState) bool) (*ChannelState, *model.AppError) {
+	for attempt := 0; attempt < maxStateUpdateAttempts; attempt++ {
+		state, oldData, appErr := p.loadChannelState(channelID)
+		if appErr != nil {
+			return nil, appErr
+		}
+
+		if !mutate(state) {
+			return state, nil
+		}
+
+		appErr = p.compareAndSetChannelState(channelID, oldData, state)
+		if appErr == nil {
+			return state, nil
+		}
+		if appErr.StatusCode != 409 {
+			return nil, appErr
+		}
+	}
+
+	p.API.LogWarn("Gave up updating channel state after repeated conflicts", "channel_id", channelID)
+	return nil, model.NewAppError("updateChannelState", "app.plugin.kv_conflict.app_error", nil, "", 409)
+}
+
+// canBypassTalkingStick reports whether userID is exempt from restrictions in channelID.
+// Decisions are cached briefly because this runs on every post.
 func (p *Plugin) canBypassTalkingStick(userID string, channelID string) (bool, error) {
-	config := p.getConfiguration()
+	if allowed, ok := p.bypassCache.get(userID, channelID); ok {
+		return allowed, nil
+	}
+
+	allowed, err := p.resolveBypass(userID, channelID)
+	if err != nil {
+		// Lookup failures are not cached so the next post retries them
+		return false, nil
+	}
+
+	p.bypassCache.set(userID, channelID, allowed)
+	return allowed, nil
+}
+
+// canModerateChannel reports whether userID may change the Talking Stick settings of
+// channelID. It rests on Mattermost permissions rather than the bypass policy, so no
+// policy change can lock administrators out.
+func (p *Plugin) canModerateChannel(userID, channelID string) bool {
+	return p.API.HasPermissionTo(userID, model.PermissionManageSystem) ||
+		p.API.HasPermissionToChannel(userID, channelID, model.PermissionManageChannelRoles)
+}
+
+// requireModerator returns denied as an ephemeral response unless the user running the
+// command may moderate the channel.
+func (p *Plugin) requireModerator(args *model.CommandArgs, denied string) *model.CommandResponse {
+	if p.canModerateChannel(args.UserId, args.ChannelId) {
+		return nil
+	}
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         denied,
+	}
+}
+
+func (p *Plugin) resolveBypass(userID string, channelID string) (bool, error) {
+	state, appErr := p.getChannelState(channelID)
+	if appErr != nil {
+		p.API.LogWarn("Failed to get channel state in bypass check", "channel_id", channelID, "error", appErr.Error())
+		return false, appErr
+	}
+	globalConfig := p.getConfiguration()
+	config := effectiveBypassPolicy(globalConfig, state.BypassOverrides)
 
 	user, err := p.API.GetUser(userID)
 	if err != nil || user == nil {
 		p.API.LogWarn("Failed to get user in bypass check", "user_id", userID, "error", err)
-		return false, nil
+		return false, err
 	}
 
-	if config.AllowBots && user.IsBot {
+	// Explicit lists are checked before any role
+	if allowed, listed := listedBypass(globalConfig, state, user); listed {
+		return allowed, nil
+	}
+
+	if config.Bots && user.IsBot {
 		return true, nil
 	}
 
-	if config.AllowSystemAdmins {
+	if config.SystemAdmins {
 		if strings.Contains(user.Roles, "system_admin") {
 			return true, nil
 		}
@@ -173,24 +415,24 @@ func (p *Plugin) canBypassTalkingStick(userID string, channelID string) (bool, e
 	member, err := p.API.GetChannelMember(channelID, userID)
 	if err != nil || member == nil {
 		p.API.LogWarn("Failed to get channel member in bypass check", "channel_id", channelID, "user_id", userID, "error", err)
-		return false, nil
+		return false, err
 	}
 
-	if config.AllowChannelAdmins && member.SchemeAdmin {
+	if config.ChannelAdmins && member.SchemeAdmin {
 		return true, nil
 	}
 
-	if config.AllowTeamAdmins {
+	if config.TeamAdmins {
 		channel, err := p.API.GetChannel(channelID)
 		if err != nil || channel == nil {
 			p.API.LogWarn("Failed to get channel in bypass check", "channel_id", channelID, "error", err)
-			return false, nil
+			return false, err
 		}
 
 		teamMember, err := p.API.GetTeamMember(channel.TeamId, userID)
 		if err != nil || teamMember == nil {
 			p.API.LogWarn("Failed to get team member in bypass check", "team_id", channel.TeamId, "user_id", userID, "error", err)
-			return false, nil
+			return false, err
 		}
 
 		if teamMember.SchemeAdmin {
@@ -212,25 +454,19 @@ func (p *Plugin) MessageWillBePosted(c *plugin.Context, post *model.Post) (*mode
 		return post, ""
 	}
 
+	// Our own announcements are never restricted
+	if post.UserId == p.botUserID {
+		return post, ""
+	}
+
 	// Suppress meta-commentary phrases
 	// This allows agents to respond to system prompts, but the responses are filtered out
-	p.API.LogInfo("MessageWillBePosted called", "message", post.Message)
-	channel, _ := p.API.GetChannel(post.ChannelId)
-	channelType := "unknown"
-	if channel != nil { channelType = string(channel.Type) }
-	p.API.LogInfo("Channel info", "channelId", post.ChannelId, "channelType", channelType)
+	p.API.LogInfo("MessageWillBePosted called", "message", post.Message, "channelId", post.ChannelId)
 	config := p.getConfiguration()
 	p.API.LogInfo("Checking suppression", "hasConfig", config.SuppressionPhrases != "", "message", post.Message)
-	if config.SuppressionPhrases != "" {
-		lowerMsg := strings.ToLower(post.Message)
-		phrases := strings.Split(config.SuppressionPhrases, "\n")
-		for _, phrase := range phrases {
-			phrase = strings.TrimSpace(strings.ToLower(phrase))
-			if phrase != "" && strings.Contains(lowerMsg, phrase) {
-				p.API.LogWarn("SUPPRESSING MESSAGE", "phrase", phrase, "message", post.Message)
-				return nil, plugin.DismissPostError // Silently suppress
-			}
-		}
+	if phrase := matchSuppressionPhrase(config, post.Message); phrase != "" {
+		p.API.LogWarn("SUPPRESSING MESSAGE", "phrase", phrase, "message", post.Message)
+		return nil, plugin.DismissPostError // Silently suppress
 	}
 
 	// Get state early for both settle and talking stick checks
@@ -246,41 +482,131 @@ func (p *Plugin) MessageWillBePosted(c *plugin.Context, post *model.Post) (*mode
 
 	// Check talking stick permissions
 	canBypass, _ := p.canBypassTalkingStick(post.UserId, post.ChannelId)
-	if canBypass {
-		return post, ""
+
+	// Settle is a circuit breaker, so it comes first and silences bots even when they bypass
+	// Only posts dropped by this channel's settle are held, never those from a team or
+	// global settle or from a muted agent
+	if reason, channelSettle := p.settleReason(post.ChannelId, post.UserId, state, canBypass); reason != "" {
+		if reason == plugin.DismissPostError && channelSettle && state.SettleRelease != "" {
+			p.holdPost(post, state.SettleRelease)
+		}
+		return nil, reason
+	}
+
+	// Questions submitted through /stick ask spent their slot when they were asked,
+	// so they skip the mode check but nothing else
+	isQuestion := state.Mode == ModeQA && p.isPendingQuestionPost(post)
+
+	// Slow mode applies on top of the speaking modes, and to bots even when they bypass them.
+	// The post is counted as soon as it fits, and uncounted if a later check rejects it.
+	limit := p.slowModeLimitFor(post.UserId, state, canBypass)
+	var slowModeStamp int64
+	if limit != nil {
+		stamp, reason := p.reserveSlowModePost(post, *limit)
+		if reason != "" {
+			return nil, reason
+		}
+		slowModeStamp = stamp
+	}
+	spentQASlot := false
+	reject := func(reason string) (*model.Post, string) {
+		if slowModeStamp != 0 {
+			p.releaseSlowModePost(post, *limit, slowModeStamp)
+		}
+		if spentQASlot {
+			p.refundQASlot(post.ChannelId, post.UserId)
+		}
+		return nil, reason
 	}
 
+	// Length is checked before the mode so a rejected post never costs a Q&A slot
+	if reason := p.enforceLengthCap(post, state, canBypass); reason != "" {
+		return reject(reason)
+	}
+
+	if !canBypass && !isQuestion {
+		reason, spent := p.enforceChannelMode(post, state)
+		if reason != "" {
+			return reject(reason)
+		}
+		spentQASlot = spent
+	}
+
+	if !p.spendBudget(post, state) {
+		return reject(plugin.DismissPostError) // Auto-settled, vanishes like a settled agent's post
+	}
+
+	return post, ""
+}
+
+// matchSuppressionPhrase returns the configured suppression phrase found in message, or "".
+func matchSuppressionPhrase(config *configuration, message string) string {
+	if config.SuppressionPhrases == "" {
+		return ""
+	}
+
+	lowerMsg := strings.ToLower(message)
+	for _, phrase := range strings.Split(config.SuppressionPhrases, "\n") {
+		phrase = strings.TrimSpace(strings.ToLower(phrase))
+		if phrase != "" && strings.Contains(lowerMsg, phrase) {
+			return phrase
+		}
+	}
+	return ""
+}
+
+// enforceChannelMode applies the channel's speaking mode to a post from a user who
+// cannot bypass the talking stick. It returns the rejection reason, or "" to allow the post,
+// and whether a Q&A slot was spent so it can be refunded if a later check rejects the post.
+func (p *Plugin) enforceChannelMode(post *model.Post, state *ChannelState) (string, bool) {
 	switch state.Mode {
 	case ModeOpen:
-		return post, ""
+		return "", false
 
 	case ModeSpeakersOnly:
-		if state.Speakers[post.UserId] {
-			return post, ""
+		if p.isSpeaker(state, post.UserId) {
+			return "", false
 		}
-		return nil, "This channel is in speakers-only mode. You do not have speaking privileges."
+		return "This channel is in speakers-only mode. You do not have speaking privileges.", false
 
 	case ModeQA:
-		if state.Speakers[post.UserId] {
-			return post, ""
+		if p.isSpeaker(state, post.UserId) {
+			return "", false
 		}
 
-		slots, hasSlots := state.QASlots[post.UserId]
-		if hasSlots && slots > 0 {
-			state.QASlots[post.UserId] = slots - 1
-			if err := p.setChannelState(post.ChannelId, state); err != nil {
-				p.API.LogError("Failed to update Q&A slots", "error", err.Error())
-			}
-			return post, ""
+		// Defaults, refills and the session cap are all applied in a single
+		// compare-and-set so concurrent posts can never spend the same slot
+		now := model.GetMillis()
+		var allowed bool
+		var reason string
+		if _, err := p.updateChannelState(post.ChannelId, func(current *ChannelState) bool {
+			allowed, reason = current.spendQASlot(post.UserId, now)
+			return allowed
+		}); err != nil {
+			p.API.LogError("Failed to update Q&A slots", "error", err.Error())
+			return "This channel is in Q&A mode and your question slot could not be reserved. Please try again.", false
 		}
-
-		return nil, "This channel is in Q&A mode. You do not have a question slot."
+		if !allowed {
+			return reason, false
+		}
+		return "", true
 
 	case ModeLocked:
-		return nil, "This channel is locked. Only administrators can post."
+		return "This channel is locked. Only administrators can post.", false
 
 	default:
-		return post, ""
+		return "", false
+	}
+}
+
+// postAnnouncement posts text to the channel as the plugin bot.
+func (p *Plugin) postAnnouncement(channelID, text string) {
+	if _, err := p.API.CreatePost(&model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channelID,
+		Message:   text,
+	}); err != nil {
+		p.API.LogError("Failed to post announcement", "channel_id", channelID, "error", err.Error())
 	}
 }
 
@@ -302,6 +628,24 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 			if split[1] == "help" {
 				return p.settleHelpResponse(), nil
 			}
+			if split[1] == "global" || split[1] == "team" {
+				return p.executeGlobalSettle(args, split[1], split[2:])
+			}
+			if split[1] == "unmute" {
+				return p.executeSettleUnmute(args, split[2:])
+			}
+			if split[1] == "purge" {
+				return p.executeSettlePurge(args, split[2:])
+			}
+			if split[1] == "limits" {
+				return p.executeSettleLimits(args, split[2:])
+			}
+			if split[1] == "off" {
+				return p.executeSettleOff(args)
+			}
+			if strings.HasPrefix(split[1], "+") {
+				return p.executeSettleExtend(args, split[1])
+			}
 		}
 		return p.executeSettle(args, split[1:])
 	}
@@ -318,12 +662,38 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 		return p.executeGrant(args, split[2:])
 	case "revoke":
 		return p.executeRevoke(args, split[2:])
+	case "reset":
+		return p.executeReset(args)
+	case "channels":
+		return p.executeChannels(args, split[2:])
+	case "export":
+		return p.executeExport(args)
+	case "import":
+		return p.executeImport(args, split[2:])
 	case "list":
 		return p.executeList(args)
 	case "mode":
 		return p.executeMode(args, split[2:])
 	case "qa-grant":
 		return p.executeQAGrant(args, split[2:])
+	case "qa-policy":
+		return p.executeQAPolicy(args, split[2:])
+	case "budget":
+		return p.executeBudget(args, split[2:])
+	case "maxlength":
+		return p.executeMaxLength(args, split[2:])
+	case "slowmode":
+		return p.executeSlowMode(args, split[2:])
+	case "bypass":
+		return p.executeBypass(args, split[2:])
+	case "freeze-edits":
+		return p.executeFreezeEdits(args, split[2:])
+	case "ask":
+		return p.executeAsk(args)
+	case "questions":
+		return p.executeQuestions(args)
+	case "answered":
+		return p.executeAnswered(args, split[2:])
 	case "help":
 		return p.helpResponse(), nil
 	default:
@@ -335,18 +705,52 @@ func (p *Plugin) helpResponse() *model.CommandResponse {
 	help := `### Talking Stick Commands
 
 **Grant/Revoke Speaking Privileges:**
-- ` + "`/stick grant @username`" + ` - Grant speaking privileges
-- ` + "`/stick revoke @username`" + ` - Revoke speaking privileges
+- ` + "`/stick grant @username [@username...] [duration]`" + ` - Grant speaking privileges, optionally expiring (e.g. ` + "`15m`" + `; also accepts ` + "`@group`" + `) (admins)
+- ` + "`/stick revoke @username [@username...]`" + ` - Revoke speaking privileges (also accepts ` + "`@group`" + `) (admins)
+- ` + "`/stick revoke --all`" + ` - Revoke everyone's speaking privileges and Q&A slots (admins)
+- ` + "`/stick reset`" + ` - Clear speakers, slots and settle, and reopen the channel (admins)
 - ` + "`/stick list`" + ` - List current speakers
+- ` + "`/stick channels [mode] [team]`" + ` - List every channel with restrictions (admins)
 
-**Channel Modes:**
+**Channel Modes (admins):**
 - ` + "`/stick mode open`" + ` - Everyone can post (default)
 - ` + "`/stick mode speakers`" + ` - Only granted speakers can post
 - ` + "`/stick mode qa`" + ` - Speakers + Q&A participants can post
 - ` + "`/stick mode locked`" + ` - Only admins can post
 
+**Agent Budgets:**
+- ` + "`/stick budget @agent 20 posts/hour`" + ` - Limit posts (or ` + "`chars`" + `) per hour or per session
+- ` + "`/stick budget @agent reset`" + ` - Refill the budget
+- ` + "`/stick budget @agent off`" + ` - Remove the budget
+
+**Slow Mode:**
+- ` + "`/stick slowmode 3 1m`" + ` - Everyone may post at most 3 messages per minute
+- ` + "`/stick slowmode bots 1 30s`" + ` - Limit bots separately (or ` + "`humans`" + `)
+- ` + "`/stick slowmode off`" + ` - Turn slow mode off
+
+**Bypass Policy:**
+- ` + "`/stick bypass`" + ` - Show who bypasses the talking stick in this channel
+- ` + "`/stick bypass bots off`" + ` - Override a global setting here (` + "`system-admins`" + `, ` + "`team-admins`" + `, ` + "`channel-admins`" + `, ` + "`bots`" + `; ` + "`on`" + `, ` + "`off`" + ` or ` + "`default`" + `)
+- ` + "`/stick bypass always @username`" + ` - Always (or ` + "`never`" + `) let specific users bypass here; ` + "`unlist`" + ` removes them
+- ` + "`/stick bypass reset`" + ` - Use the global settings again (admins)
+
+**Edits:**
+- ` + "`/stick freeze-edits on`" + ` - Reject all edits while the channel is locked (` + "`off`" + ` to allow)
+
+**Message Length Caps:**
+- ` + "`/stick maxlength bots 2000 chars`" + ` - Cap message length for ` + "`bots`" + `, ` + "`speakers`" + ` or ` + "`audience`" + ` (or ` + "`lines`" + `)
+- ` + "`/stick maxlength action truncate`" + ` - Truncate long messages instead of rejecting them
+
 **Q&A Mode:**
-- ` + "`/stick qa-grant @username [count]`" + ` - Grant question slots (default: 1)
+- ` + "`/stick qa-grant @username [@username...] [count]`" + ` - Grant question slots (default: 1) (admins)
+- ` + "`/stick qa-policy`" + ` - Show or set default slots, refills and per-session caps
+- ` + "`/stick ask <question>`" + ` - Submit a question to the board (upvote with :+1:)
+- ` + "`/stick questions`" + ` - Show questions ranked by upvotes
+- ` + "`/stick answered <number>`" + ` - Mark a question as answered (moderators)
+
+**Export/Import:**
+- ` + "`/stick export`" + ` - Send this channel's settings to you as a JSON file (admins)
+- ` + "`/stick import [post link]`" + ` - Apply an exported JSON file (admins)
 
 **Help:**
 - ` + "`/stick help`" + ` - Show this help message
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryKV is an in-memory KV store with the compare-and-set semantics of the server.
+type memoryKV struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func newMemoryKV() *memoryKV {
+	return &memoryKV{values: make(map[string][]byte)}
+}
+
+func (kv *memoryKV) get(key string) ([]byte, *model.AppError) {
+	kv.mu.Lock()
+	value := kv.values[key]
+	kv.mu.Unlock()
+
+	// Give other goroutines a chance to write between our read and our write
+	runtime.Gosched()
+	return value, nil
+}
+
+func (kv *memoryKV) compareAndSet(key string, oldValue, newValue []byte) (bool, *model.AppError) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	current, exists := kv.values[key]
+	if oldValue == nil && exists || oldValue != nil && (!exists || !bytes.Equal(current, oldValue)) {
+		return false, nil
+	}
+	kv.values[key] = append([]byte(nil), newValue...)
+	return true, nil
+}
+
+func (kv *memoryKV) compareAndDelete(key string, oldValue []byte) (bool, *model.AppError) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if current, exists := kv.values[key]; !exists || !bytes.Equal(current, oldValue) {
+		return false, nil
+	}
+	delete(kv.values, key)
+	return true, nil
+}
+
+// put writes state directly, as another node would.
+func (kv *memoryKV) put(t *testing.T, channelID string, state *ChannelState) {
+	t.Helper()
+
+	data, err := json.Marshal(state)
+	require.NoError(t, err)
+
+	kv.mu.Lock()
+	kv.values["channel_"+channelID] = data
+	kv.mu.Unlock()
+}
+
+func setupStatePlugin(t *testing.T) (*Plugin, *memoryKV) {
+	t.Helper()
+
+	kv := newMemoryKV()
+	api := &plugintest.API{}
+	api.On("KVGet", mock.Anything).Return(kv.get)
+	api.On("KVCompareAndSet", mock.Anything, mock.Anything, mock.Anything).Return(kv.compareAndSet)
+	api.On("KVCompareAndDelete", mock.Anything, mock.Anything).Return(kv.compareAndDelete)
+	api.On("PublishPluginClusterEvent", mock.Anything, mock.Anything).Return(nil)
+	api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything).Maybe()
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.stateCache = newChannelStateCache(stateCacheSize, stateCacheTTL)
+	return p, kv
+}
+
+func TestUpdateChannelStateConcurrentWritesAreNotLost(t *testing.T) {
+	p, _ := setupStatePlugin(t)
+	channelID := model.NewId()
+
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make([]*model.AppError, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = p.updateChannelState(channelID, func(state *ChannelState) bool {
+				state.Speakers[fmt.Sprintf("user%d", i)] = &SpeakerGrant{}
+				return true
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		require.Nil(t, err, "writer %d", i)
+	}
+
+	p.stateCache.remove(channelID)
+	state, appErr := p.getChannelState(channelID)
+	require.Nil(t, appErr)
+	assert.Len(t, state.Speakers, writers)
+	assert.EqualValues(t, writers, state.Version)
+}
+
+func TestSpendQASlotConcurrentlyNeverSpendsASlotTwice(t *testing.T) {
+	p, kv := setupStatePlugin(t)
+	channelID := model.NewId()
+	userID := model.NewId()
+
+	const slots = 3
+	initial := newChannelState()
+	initial.Mode = ModeQA
+	initial.QASlots[userID] = slots
+	initial.QALastRefill[userID] = 1 // Not the first post of the session, so no default allowance
+	kv.put(t, channelID, initial)
+
+	const posters = 8
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	spent := 0
+	for i := 0; i < posters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var allowed bool
+			_, err := p.updateChannelState(channelID, func(state *ChannelState) bool {
+				allowed, _ = state.spendQASlot(userID, model.GetMillis())
+				return allowed
+			})
+			assert.Nil(t, err)
+			if allowed {
+				mu.Lock()
+				spent++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, slots, spent)
+
+	p.stateCache.remove(channelID)
+	state, appErr := p.getChannelState(channelID)
+	require.Nil(t, appErr)
+	assert.Equal(t, 0, state.QASlots[userID])
+	assert.Equal(t, slots, state.QAUsed[userID])
+}
+
+func TestUpdateChannelStateRetriesOnStaleCache(t *testing.T) {
+	p, kv := setupStatePlugin(t)
+	channelID := model.NewId()
+
+	// Warm this node's cache, then let another node write behind its back
+	_, appErr := p.updateChannelState(channelID, func(state *ChannelState) bool {
+		state.Speakers["alice"] = &SpeakerGrant{}
+		return true
+	})
+	require.Nil(t, appErr)
+
+	remote, appErr := p.getChannelState(channelID)
+	require.Nil(t, appErr)
+	remote.Speakers["bob"] = &SpeakerGrant{}
+	remote.Version++
+	kv.put(t, channelID, remote)
+
+	attempts := 0
+	state, appErr := p.updateChannelState(channelID, func(state *ChannelState) bool {
+		attempts++
+		state.Speakers["carol"] = &SpeakerGrant{}
+		return true
+	})
+	require.Nil(t, appErr)
+
+	assert.Equal(t, 2, attempts)
+	assert.Contains(t, state.Speakers, "alice")
+	assert.Contains(t, state.Speakers, "bob")
+	assert.Contains(t, state.Speakers, "carol")
+}
+
+func TestBudgetRejectionRefundsTheQASlot(t *testing.T) {
+	p, kv := setupStatePlugin(t)
+	p.bypassCache = newBypassCache()
+	channelID := model.NewId()
+	teamID := model.NewId()
+	userID := model.NewId()
+
+	api := p.API.(*plugintest.API)
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	api.On("GetUser", userID).Return(&model.User{Id: userID, Username: "agent", Roles: model.SystemUserRoleId}, nil)
+	api.On("GetChannelMember", channelID, userID).Return(&model.ChannelMember{ChannelId: channelID, UserId: userID}, nil)
+	api.On("GetChannel", channelID).Return(&model.Channel{Id: channelID, TeamId: teamID}, nil).Maybe()
+	api.On("GetTeamMember", teamID, userID).Return(&model.TeamMember{TeamId: teamID, UserId: userID}, nil)
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil).Maybe()
+
+	initial := newChannelState()
+	initial.Mode = ModeQA
+	initial.QASlots[userID] = 1
+	initial.QALastRefill[userID] = 1
+	initial.Budgets[userID] = &AgentBudget{Posts: BudgetAllowance{Limit: 1, Used: 1, Period: BudgetPeriodSession}}
+	kv.put(t, channelID, initial)
+
+	_, reason := p.MessageWillBePosted(nil, &model.Post{UserId: userID, ChannelId: channelID, Message: "hello"})
+	assert.Equal(t, plugin.DismissPostError, reason)
+
+	p.stateCache.remove(channelID)
+	state, appErr := p.getChannelState(channelID)
+	require.Nil(t, appErr)
+	assert.Equal(t, 1, state.QASlots[userID])
+	assert.Equal(t, 0, state.QAUsed[userID])
+	assert.True(t, state.Budgets[userID].Exhausted)
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// pluginID must match the id in plugin.json. It builds URLs the server calls back on.
+const pluginID = "com.gitschool.talking-stick"
+
+// maxPurgeWindow bounds how far back /settle purge reaches.
+const maxPurgeWindow = time.Hour
+
+// purgeConfirmTimeout is how long the confirmation dialog stays valid.
+const purgeConfirmTimeout = 15 * time.Minute
+
+const (
+	PurgeActionDelete  = "delete"
+	PurgeActionArchive = "archive"
+)
+
+// purgeRequest is carried in the confirmation dialog's state, so the posts deleted are
+// the ones the moderator was shown.
+type purgeRequest struct {
+	ChannelID string   `json:"channel_id"`
+	Since     int64    `json:"since"` // Unix timestamp in milliseconds
+	Until     int64    `json:"until"` // Unix timestamp in milliseconds
+	Window    string   `json:"window"`
+	AgentIDs  []string `json:"agent_ids"` // Bots to purge, empty purges every bot
+}
+
+// validatePurgeRequest checks a request coming back from the confirmation dialog, whose state the
+// client could have changed. It returns what is wrong with it, or "".
+func (p *Plugin) validatePurgeRequest(request *purgeRequest, now int64) string {
+	if request.Since <= 0 || request.Until < request.Since || request.Until > now {
+		return "invalid purge window"
+	}
+	if request.Until-request.Since > maxPurgeWindow.Milliseconds() {
+		return "purge window is too long"
+	}
+	if now-request.Until > purgeConfirmTimeout.Milliseconds() {
+		return "purge confirmation has expired, run /settle purge again"
+	}
+	for _, agentID := range request.AgentIDs {
+		if !p.isBotUser(agentID) {
+			return "only bot posts can be purged"
+		}
+	}
+	return ""
+}
+
+// purgeCandidates returns the posts a purge would remove, oldest first: bot posts in
+// the window, limited to the named agents when there are any. Posts from humans and
+// the plugin's own posts are always kept.
+func (p *Plugin) purgeCandidates(request *purgeRequest) ([]*model.Post, *model.AppError) {
+	postList, appErr := p.API.GetPostsSince(request.ChannelID, request.Since)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	agents := make(map[string]bool)
+	for _, agentID := range request.AgentIDs {
+		agents[agentID] = true
+	}
+
+	var posts []*model.Post
+	for _, post := range postList.Posts {
+		if post.DeleteAt != 0 || post.IsSystemMessage() || post.UserId == p.botUserID {
+			continue
+		}
+		if post.CreateAt < request.Since || post.CreateAt > request.Until {
+			continue
+		}
+		if len(agents) > 0 && !agents[post.UserId] {
+			continue
+		}
+		if !p.isBotUser(post.UserId) {
+			continue
+		}
+		posts = append(posts, post)
+	}
+
+	sort.Slice(posts, func(i, j int) bool { return posts[i].CreateAt < posts[j].CreateAt })
+	return posts, nil
+}
+
+// executeSettlePurge handles /settle purge <window> [@agent...] by asking for confirmation.
+func (p *Plugin) executeSettlePurge(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	if response := p.requireSettlePermission(args); response != nil {
+		return response, nil
+	}
+
+	if len(params) == 0 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Usage: `/settle purge <window> [@agent...]`, e.g. `/settle purge 5m`",
+		}, nil
+	}
+
+	window, ok := parseSettleDuration(params[0])
+	if !ok {
+		return invalidSettleDuration(params[0]), nil
+	}
+	if window > maxPurgeWindow {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("Purges can reach back at most %s.", formatSettleDuration(maxPurgeWindow)),
+		}, nil
+	}
+
+	targets := p.resolveTargets(params[1:], false)
+	if len(targets.notFound) > 0 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("User not found: %s", strings.Join(targets.notFound, ", ")),
+		}, nil
+	}
+
+	var humans []string
+	for userID, username := range targets.users {
+		if !p.isBotUser(userID) {
+			humans = append(humans, "@"+username)
+		}
+	}
+	if len(humans) > 0 {
+		sort.Strings(humans)
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("Only bot posts can be purged. Not a bot: %s", strings.Join(humans, ", ")),
+		}, nil
+	}
+
+	now := model.GetMillis()
+	request := &purgeRequest{
+		ChannelID: args.ChannelId,
+		Since:     now - window.Milliseconds(),
+		Until:     now,
+		Window:    formatSettleDuration(window),
+		AgentIDs:  []string{},
+	}
+	for userID := range targets.users {
+		request.AgentIDs = append(request.AgentIDs, userID)
+	}
+
+	posts, appErr := p.purgeCandidates(request)
+	if appErr != nil {
+		p.API.LogError("Failed to find posts to purge", "channel_id", args.ChannelId, "error", appErr.Error())
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to find posts to purge.",
+		}, nil
+	}
+	if len(posts) == 0 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("No posts to purge from the last %s.", request.Window),
+		}, nil
+	}
+
+	state, err := json.Marshal(request)
+	if err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to prepare the purge.",
+		}, nil
+	}
+
+	from := "bots"
+	if len(targets.users) > 0 {
+		from = targets.mentions()
+	}
+
+	if appErr := p.API.OpenInteractiveDialog(model.OpenDialogRequest{
+		TriggerId: args.TriggerId,
+		URL:       fmt.Sprintf("/plugins/%s/api/v1/purge", pluginID),
+		Dialog: model.Dialog{
+			CallbackId:       "purge",
+			Title:            "Purge doom loop posts",
+			IntroductionText: fmt.Sprintf("This will remove **%d %s** from %s in the last %s. This can't be undone.", len(posts), pluralize(len(posts), "post", "posts"), from, request.Window),
+			Elements: []model.DialogElement{{
+				DisplayName: "Action",
+				Name:        "action",
+				Type:        "radio",
+				Default:     PurgeActionDelete,
+				Options: []*model.PostActionOptions{
+					{Text: "Delete the posts", Value: PurgeActionDelete},
+					{Text: "Move the posts into an archive thread", Value: PurgeActionArchive},
+				},
+			}},
+			SubmitLabel: "Purge",
+			State:       string(state),
+		},
+	}); appErr != nil {
+		p.API.LogError("Failed to open purge dialog", "error", appErr.Error())
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to open the purge confirmation.",
+		}, nil
+	}
+
+	return &model.CommandResponse{}, nil
+}
+
+// servePurge handles the confirmation dialog submission.
+func (p *Plugin) servePurge(w http.ResponseWriter, r *http.Request, userID string) {
+	var submission model.SubmitDialogRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxImportSize)).Decode(&submission); err != nil {
+		http.Error(w, "invalid dialog submission", http.StatusBadRequest)
+		return
+	}
+	if submission.Cancelled {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var request purgeRequest
+	if err := json.Unmarshal([]byte(submission.State), &request); err != nil || request.ChannelID != submission.ChannelId {
+		http.Error(w, "invalid purge request", http.StatusBadRequest)
+		return
+	}
+
+	if !p.canModerateChannel(userID, request.ChannelID) {
+		http.Error(w, "only administrators can purge posts", http.StatusForbidden)
+		return
+	}
+
+	if problem := p.validatePurgeRequest(&request, model.GetMillis()); problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+	request.Window = formatSettleDuration(time.Duration(request.Until-request.Since) * time.Millisecond)
+
+	action, _ := submission.Submission["action"].(string)
+	if action != PurgeActionDelete && action != PurgeActionArchive {
+		writeDialogResponse(w, &model.SubmitDialogResponse{Errors: map[string]string{"action": "Choose an action."}})
+		return
+	}
+
+	removed, appErr := p.purgePosts(userID, &request, action)
+	if appErr != nil {
+		writeDialogResponse(w, &model.SubmitDialogResponse{Error: "Failed to purge posts. Some posts may already have been removed."})
+		return
+	}
+
+	text := fmt.Sprintf("%s purged %d %s from the last %s.", p.issuerUsername(userID), removed, pluralize(removed, "post", "posts"), request.Window)
+	if action == PurgeActionArchive {
+		text = fmt.Sprintf("%s moved %d %s from the last %s into an archive thread.", p.issuerUsername(userID), removed, pluralize(removed, "post", "posts"), request.Window)
+	}
+	p.postAnnouncement(request.ChannelID, text)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// purgePosts removes the request's posts, archiving them first when asked, and records
+// the purge in the audit log. It returns how many posts were removed.
+func (p *Plugin) purgePosts(userID string, request *purgeRequest, action string) (int, *model.AppError) {
+	record := &model.AuditRecord{
+		EventName: "talkingStickPurge",
+		Status:    model.AuditStatusAttempt,
+		Actor:     model.AuditEventActor{UserId: userID},
+	}
+	record.AddEventObjectType("post")
+	model.AddEventParameterToAuditRec(record, "channel_id", request.ChannelID)
+	model.AddEventParameterToAuditRec(record, "since", request.Since)
+	model.AddEventParameterToAuditRec(record, "until", request.Until)
+	model.AddEventParameterToAuditRec(record, "agent_ids", request.AgentIDs)
+	model.AddEventParameterToAuditRec(record, "action", action)
+	defer p.logAudit(record)
+
+	posts, appErr := p.purgeCandidates(request)
+	if appErr != nil {
+		record.Fail()
+		record.AddAppError(appErr)
+		return 0, appErr
+	}
+
+	var archiveRootID string
+	if action == PurgeActionArchive && len(posts) > 0 {
+		root, appErr := p.API.CreatePost(&model.Post{
+			UserId:    p.botUserID,
+			ChannelId: request.ChannelID,
+			Message:   fmt.Sprintf("#### Archived posts from the last %s\n%d %s removed from the channel during a purge are kept in this thread.", request.Window, len(posts), pluralize(len(posts), "post was", "posts were")),
+		})
+		if appErr != nil {
+			record.Fail()
+			record.AddAppError(appErr)
+			return 0, appErr
+		}
+		archiveRootID = root.Id
+	}
+
+	removed := 0
+	var postIDs []string
+	for _, post := range posts {
+		if archiveRootID != "" {
+			username := "unknown"
+			if user, err := p.API.GetUser(post.UserId); err == nil && user != nil {
+				username = user.Username
+			}
+			message := formatHeldPost(HeldPost{UserID: post.UserId, Message: post.Message, CreateAt: post.CreateAt}, username, false)
+			if len(post.FileIds) > 0 {
+				// Files are deleted along with their post, so they can't be moved
+				message += fmt.Sprintf("\n_%d %s not archived._", len(post.FileIds), pluralize(len(post.FileIds), "attachment", "attachments"))
+			}
+			if _, appErr := p.API.CreatePost(&model.Post{
+				UserId:    p.botUserID,
+				ChannelId: request.ChannelID,
+				RootId:    archiveRootID,
+				Message:   message,
+			}); appErr != nil {
+				p.API.LogError("Failed to archive post, keeping it", "post_id", post.Id, "error", appErr.Error())
+				continue
+			}
+		}
+
+		if appErr := p.API.DeletePost(post.Id); appErr != nil {
+			p.API.LogError("Failed to delete post during purge", "post_id", post.Id, "error", appErr.Error())
+			continue
+		}
+		removed++
+		postIDs = append(postIDs, post.Id)
+	}
+
+	model.AddEventParameterToAuditRec(record, "post_ids", postIDs)
+	record.AddMeta("removed", removed)
+	record.Success()
+	return removed, nil
+}
+
+// logAudit writes record to the server audit log where supported, and always to the
+// plugin log.
+func (p *Plugin) logAudit(record *model.AuditRecord) {
+	p.API.LogInfo("Audit", "event", record.EventName, "status", record.Status, "user_id", record.Actor.UserId, "parameters", record.EventData.Parameters, "meta", record.Meta)
+
+	var major, minor int
+	if _, err := fmt.Sscanf(p.API.GetServerVersion(), "%d.%d", &major, &minor); err != nil {
+		return
+	}
+	if major > 10 || (major == 10 && minor >= 10) { // LogAuditRec needs server 10.10
+		p.API.LogAuditRec(record)
+	}
+}
+
+func writeDialogResponse(w http.ResponseWriter, response *model.SubmitDialogResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "failed to write response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// QAPolicy controls how question slots are handed out while a channel is in Q&A mode.
+type QAPolicy struct {
+	DefaultSlots   int   `json:"default_slots"`   // Slots every member starts each Q&A session with
+	RefillInterval int64 `json:"refill_interval"` // Seconds per refilled slot, 0 disables refills
+	SessionCap     int   `json:"session_cap"`     // Max questions per member per session, 0 is unlimited
+}
+
+func (q QAPolicy) isDefault() bool {
+	return q == QAPolicy{}
+}
+
+// startQASession resets per-session slot tracking. Explicit grants from /stick qa-grant are kept.
+func (s *ChannelState) startQASession(now int64) {
+	s.QASessionStart = now
+	s.QAUsed = make(map[string]int)
+	s.QALastRefill = make(map[string]int64)
+}
+
+// availableQASlots applies the default allowance and any refills due for userID at now,
+// updating the state in place, and returns the slots the user currently holds.
+func (s *ChannelState) availableQASlots(userID string, now int64) int {
+	slots := s.QASlots[userID]
+
+	lastRefill, seen := s.QALastRefill[userID]
+	if !seen {
+		// First post this session - hand out the default allowance
+		if slots < s.QAPolicy.DefaultSlots {
+			slots = s.QAPolicy.DefaultSlots
+		}
+		// Refills count from the session start, so they accrue even while every attempt
+		// is rejected and nothing about the user is saved
+		lastRefill = s.QASessionStart
+		if lastRefill <= 0 || lastRefill > now {
+			lastRefill = now
+		}
+	}
+
+	if interval := s.QAPolicy.RefillInterval * 1000; interval > 0 {
+		refillCap := s.QAPolicy.DefaultSlots
+		if refillCap < 1 {
+			refillCap = 1
+		}
+
+		refills := (now - lastRefill) / interval
+		lastRefill += refills * interval
+		for ; refills > 0 && slots < refillCap; refills-- {
+			slots++
+		}
+	}
+
+	s.QASlots[userID] = slots
+	s.QALastRefill[userID] = lastRefill
+
+	return slots
+}
+
+// spendQASlot consumes one question slot for userID. It returns false and the
+// reason to show the author when no slot can be spent.
+func (s *ChannelState) spendQASlot(userID string, now int64) (bool, string) {
+	if s.QAPolicy.SessionCap > 0 && s.QAUsed[userID] >= s.QAPolicy.SessionCap {
+		return false, fmt.Sprintf("This channel is in Q&A mode. You have used all %d of your questions for this session.", s.QAPolicy.SessionCap)
+	}
+
+	slots := s.availableQASlots(userID, now)
+	if slots <= 0 {
+		if s.QAPolicy.RefillInterval > 0 {
+			next := time.UnixMilli(s.QALastRefill[userID] + s.QAPolicy.RefillInterval*1000)
+			wait := time.Until(next).Round(time.Second)
+			return false, fmt.Sprintf("This channel is in Q&A mode. You will receive a question slot in %s.", wait)
+		}
+		return false, "This channel is in Q&A mode. You do not have a question slot."
+	}
+
+	s.QASlots[userID] = slots - 1
+	s.QAUsed[userID]++
+	return true, ""
+}
+
+// refundQASlot gives back a slot spent on a question that was never posted.
+func (s *ChannelState) refundQASlot(userID string) {
+	s.QASlots[userID]++
+	if s.QAUsed[userID] > 0 {
+		s.QAUsed[userID]--
+	}
+}
+
+func (p *Plugin) executeQAPolicy(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	if len(params) == 0 {
+		state, err := p.getChannelState(args.ChannelId)
+		if err != nil {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         "Failed to get channel state.",
+			}, nil
+		}
+
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("### Q&A Slot Policy\n\n%s", describeQAPolicy(state.QAPolicy)),
+		}, nil
+	}
+
+	if response := p.requireModerator(args, "Only administrators can change the Q&A slot policy."); response != nil {
+		return response, nil
+	}
+
+	if len(params) < 2 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Usage: `/stick qa-policy [default <count>|refill <duration|off>|cap <count|off>]`",
+		}, nil
+	}
+
+	var apply func(policy *QAPolicy)
+	value := params[1]
+	switch params[0] {
+	case "default":
+		count, convErr := strconv.Atoi(value)
+		if convErr != nil || count < 0 {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         "Invalid default slot count. Must be zero or a positive number.",
+			}, nil
+		}
+		apply = func(policy *QAPolicy) { policy.DefaultSlots = count }
+
+	case "refill":
+		if value == "off" || value == "0" {
+			apply = func(policy *QAPolicy) { policy.RefillInterval = 0 }
+			break
+		}
+		interval, parseErr := time.ParseDuration(value)
+		if parseErr != nil || interval < time.Second {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         "Invalid refill interval. Use a duration such as `10m` or `90s`, or `off`.",
+			}, nil
+		}
+		apply = func(policy *QAPolicy) { policy.RefillInterval = int64(interval / time.Second) }
+
+	case "cap":
+		if value == "off" {
+			value = "0"
+		}
+		limit, convErr := strconv.Atoi(value)
+		if convErr != nil || limit < 0 {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         "Invalid session cap. Must be a positive number or `off`.",
+			}, nil
+		}
+		apply = func(policy *QAPolicy) { policy.SessionCap = limit }
+
+	default:
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Usage: `/stick qa-policy [default <count>|refill <duration|off>|cap <count|off>]`",
+		}, nil
+	}
+
+	state, err := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		apply(&state.QAPolicy)
+		return true
+	})
+	if err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to update Q&A slot policy.",
+		}, nil
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         fmt.Sprintf("Q&A slot policy updated.\n\n%s", describeQAPolicy(state.QAPolicy)),
+	}, nil
+}
+
+func describeQAPolicy(policy QAPolicy) string {
+	var lines []string
+
+	if policy.DefaultSlots > 0 {
+		lines = append(lines, fmt.Sprintf("- Every member starts with %d slot(s) per session", policy.DefaultSlots))
+	} else {
+		lines = append(lines, "- No default slots (use `/stick qa-grant`)")
+	}
+
+	if policy.RefillInterval > 0 {
+		lines = append(lines, fmt.Sprintf("- One slot refills every %s", time.Duration(policy.RefillInterval)*time.Second))
+	} else {
+		lines = append(lines, "- Slots do not refill")
+	}
+
+	if policy.SessionCap > 0 {
+		lines = append(lines, fmt.Sprintf("- At most %d question(s) per member per session", policy.SessionCap))
+	} else {
+		lines = append(lines, "- No per-session cap")
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpendQASlotRefillsWithoutADefaultAllowance(t *testing.T) {
+	p, kv := setupStatePlugin(t)
+	channelID := model.NewId()
+	userID := model.NewId()
+
+	const interval = 60 // Seconds
+	start := model.GetMillis()
+	initial := newChannelState()
+	initial.Mode = ModeQA
+	initial.QAPolicy = QAPolicy{RefillInterval: interval}
+	initial.startQASession(start)
+	kv.put(t, channelID, initial)
+
+	spend := func(now int64) bool {
+		t.Helper()
+		var allowed bool
+		_, appErr := p.updateChannelState(channelID, func(state *ChannelState) bool {
+			allowed, _ = state.spendQASlot(userID, now)
+			return allowed
+		})
+		require.Nil(t, appErr)
+		return allowed
+	}
+
+	assert.False(t, spend(start+1000), "no slot before the first refill")
+	assert.True(t, spend(start+interval*1000+1000), "one slot after a refill interval")
+	assert.False(t, spend(start+interval*1000+2000), "the refilled slot was spent")
+	assert.True(t, spend(start+2*interval*1000+1000), "another slot after the next interval")
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+// UpvoteEmoji is the reaction that counts as an upvote on a question post.
+const UpvoteEmoji = "+1"
+
+// QuestionPropKey marks a post created by /stick ask so MessageWillBePosted can let it through.
+const QuestionPropKey = "talking_stick_question"
+
+type Question struct {
+	ID       int             `json:"id"`
+	PostID   string          `json:"post_id"`
+	UserID   string          `json:"user_id"`
+	Text     string          `json:"text"`
+	Votes    map[string]bool `json:"votes"`
+	Answered bool            `json:"answered"`
+	CreateAt int64           `json:"create_at"` // Unix timestamp in milliseconds
+}
+
+type QuestionBoard struct {
+	NextID    int         `json:"next_id"`
+	Questions []*Question `json:"questions"`
+}
+
+func (b *QuestionBoard) findByID(id int) *Question {
+	for _, q := range b.Questions {
+		if q.ID == id {
+			return q
+		}
+	}
+	return nil
+}
+
+func (b *QuestionBoard) findByPostID(postID string) *Question {
+	for _, q := range b.Questions {
+		if q.PostID != "" && q.PostID == postID {
+			return q
+		}
+	}
+	return nil
+}
+
+func (b *QuestionBoard) remove(id int) {
+	for i, q := range b.Questions {
+		if q.ID == id {
+			b.Questions = append(b.Questions[:i], b.Questions[i+1:]...)
+			return
+		}
+	}
+}
+
+// ranked returns the questions ordered by popularity: open questions first,
+// then by vote count, with earlier questions winning ties.
+func (b *QuestionBoard) ranked() []*Question {
+	ranked := make([]*Question, 0, len(b.Questions))
+	for _, q := range b.Questions {
+		if q.PostID == "" {
+			continue // Still being posted
+		}
+		ranked = append(ranked, q)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Answered != ranked[j].Answered {
+			return !ranked[i].Answered
+		}
+		if len(ranked[i].Votes) != len(ranked[j].Votes) {
+			return len(ranked[i].Votes) > len(ranked[j].Votes)
+		}
+		return ranked[i].CreateAt < ranked[j].CreateAt
+	})
+
+	return ranked
+}
+
+func (p *Plugin) getQuestionBoard(channelID string) (*QuestionBoard, *model.AppError) {
+	board, _, err := p.loadQuestionBoard(channelID)
+	return board, err
+}
+
+// loadQuestionBoard returns the board together with the raw bytes it was decoded
+// from, which are nil when the channel has no questions yet.
+func (p *Plugin) loadQuestionBoard(channelID string) (*QuestionBoard, []byte, *model.AppError) {
+	key := fmt.Sprintf("questions_%s", channelID)
+	data, err := p.API.KVGet(key)
+	if err != nil {
+		return nil, nil, model.NewAppError("getQuestionBoard", "app.plugin.kv_get.app_error", nil, "", 500)
+	}
+
+	if data == nil {
+		return &QuestionBoard{NextID: 1, Questions: []*Question{}}, nil, nil
+	}
+
+	var board QuestionBoard
+	if err := json.Unmarshal(data, &board); err != nil {
+		return nil, nil, model.NewAppError("getQuestionBoard", "app.plugin.unmarshal.app_error", nil, "", 500)
+	}
+
+	if board.NextID < 1 {
+		board.NextID = 1
+	}
+	for _, q := range board.Questions {
+		if q.Votes == nil {
+			q.Votes = make(map[string]bool)
+		}
+	}
+
+	return &board, data, nil
+}
+
+// updateQuestionBoard applies mutate to the latest stored board and saves it with
+// compare-and-set, retrying when a concurrent vote or question got there first.
+// If mutate returns false nothing is written.
+func (p *Plugin) updateQuestionBoard(channelID string, mutate func(board *QuestionBoard) bool) (*QuestionBoard, *model.AppError) {
+	key := fmt.Sprintf("questions_%s", channelID)
+
+	for attempt := 0; attempt < maxStateUpdateAttempts; attempt++ {
+		board, oldData, appErr := p.loadQuestionBoard(channelID)
+		if appErr != nil {
+			return nil, appErr
+		}
+
+		if !mutate(board) {
+			return board, nil
+		}
+
+		data, err := json.Marshal(board)
+		if err != nil {
+			return nil, model.NewAppError("updateQuestionBoard", "app.plugin.marshal.app_error", nil, "", 500)
+		}
+
+		ok, appErr := p.API.KVCompareAndSet(key, oldData, data)
+		if appErr != nil {
+			return nil, model.NewAppError("updateQuestionBoard", "app.plugin.kv_set.app_error", nil, "", 500)
+		}
+		if ok {
+			return board, nil
+		}
+	}
+
+	p.API.LogWarn("Gave up updating question board after repeated conflicts", "channel_id", channelID)
+	return nil, model.NewAppError("updateQuestionBoard", "app.plugin.kv_conflict.app_error", nil, "", 409)
+}
+
+// questionView is the representation of a question sent to the webapp.
+type questionView struct {
+	ID       int    `json:"id"`
+	PostID   string `json:"post_id"`
+	Username string `json:"username"`
+	Text     string `json:"text"`
+	Votes    int    `json:"votes"`
+	Answered bool   `json:"answered"`
+}
+
+func (p *Plugin) questionViews(board *QuestionBoard) []questionView {
+	views := []questionView{}
+	for _, q := range board.ranked() {
+		username := "unknown"
+		if user, err := p.API.GetUser(q.UserID); err == nil && user != nil {
+			username = user.Username
+		}
+		views = append(views, questionView{
+			ID:       q.ID,
+			PostID:   q.PostID,
+			Username: username,
+			Text:     q.Text,
+			Votes:    len(q.Votes),
+			Answered: q.Answered,
+		})
+	}
+	return views
+}
+
+// publishQuestions pushes the ranked board to everyone in the channel so the RHS stays current.
+func (p *Plugin) publishQuestions(channelID string, board *QuestionBoard) {
+	data, err := json.Marshal(p.questionViews(board))
+	if err != nil {
+		p.API.LogWarn("Failed to marshal questions for websocket event", "channel_id", channelID, "error", err)
+		return
+	}
+
+	p.API.PublishWebSocketEvent("questions_updated", map[string]any{
+		"channel_id": channelID,
+		"questions":  string(data),
+	}, &model.WebsocketBroadcast{ChannelId: channelID})
+}
+
+// isPendingQuestionPost reports whether post is the post being created by /stick ask
+// for a question that has not been attached to a post yet.
+func (p *Plugin) isPendingQuestionPost(post *model.Post) bool {
+	raw, ok := post.GetProp(QuestionPropKey).(string)
+	if !ok || raw == "" {
+		return false
+	}
+
+	id, err := strconv.Atoi(raw)
+	if err != nil {
+		return false
+	}
+
+	board, appErr := p.getQuestionBoard(post.ChannelId)
+	if appErr != nil {
+		return false
+	}
+
+	q := board.findByID(id)
+	return q != nil && q.PostID == "" && q.UserID == post.UserId
+}
+
+func (p *Plugin) executeAsk(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	// Take the question from the raw command so whitespace and formatting survive
+	text := strings.TrimSpace(args.Command)
+	text = strings.TrimSpace(strings.TrimPrefix(text, strings.Fields(text)[0]))
+	text = strings.TrimSpace(strings.TrimPrefix(text, "ask"))
+
+	if text == "" {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Usage: `/stick ask <question>`",
+		}, nil
+	}
+
+	state, appErr := p.getChannelState(args.ChannelId)
+	if appErr != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to get channel state.",
+		}, nil
+	}
+
+	if state.Mode != ModeQA {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Questions can only be asked while the channel is in Q&A mode.",
+		}, nil
+	}
+
+	// Asking spends a question slot, just like posting does in Q&A mode
+	canBypass, _ := p.canBypassTalkingStick(args.UserId, args.ChannelId)
+	spendsSlot := !canBypass && !p.isSpeaker(state, args.UserId)
+	if spendsSlot {
+		now := model.GetMillis()
+		var allowed bool
+		var reason string
+		if _, err := p.updateChannelState(args.ChannelId, func(current *ChannelState) bool {
+			allowed, reason = current.spendQASlot(args.UserId, now)
+			return allowed
+		}); err != nil {
+			p.API.LogError("Failed to update Q&A slots", "error", err.Error())
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         "Your question slot could not be reserved. Please try again.",
+			}, nil
+		}
+		if !allowed {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         reason,
+			}, nil
+		}
+	}
+
+	// Record the question before posting so MessageWillBePosted recognizes the post
+	var question *Question
+	if _, err := p.updateQuestionBoard(args.ChannelId, func(board *QuestionBoard) bool {
+		question = &Question{
+			ID:       board.NextID,
+			UserID:   args.UserId,
+			Text:     text,
+			Votes:    make(map[string]bool),
+			CreateAt: model.GetMillis(),
+		}
+		board.NextID++
+		board.Questions = append(board.Questions, question)
+		return true
+	}); err != nil {
+		if spendsSlot {
+			p.refundQASlot(args.ChannelId, args.UserId)
+		}
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to save question.",
+		}, nil
+	}
+
+	post := &model.Post{
+		UserId:    args.UserId,
+		ChannelId: args.ChannelId,
+		Message:   fmt.Sprintf("**Question #%d:** %s\n\n_React with :%s: to upvote._", question.ID, text, UpvoteEmoji),
+	}
+	post.AddProp(QuestionPropKey, strconv.Itoa(question.ID))
+
+	created, appErr := p.API.CreatePost(post)
+	if appErr != nil {
+		p.API.LogError("Failed to create question post", "channel_id", args.ChannelId, "error", appErr.Error())
+		if _, err := p.updateQuestionBoard(args.ChannelId, func(board *QuestionBoard) bool {
+			board.remove(question.ID)
+			return true
+		}); err != nil {
+			p.API.LogError("Failed to remove unposted question", "error", err.Error())
+		}
+		if spendsSlot {
+			p.refundQASlot(args.ChannelId, args.UserId)
+		}
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to post question.",
+		}, nil
+	}
+
+	board, appErr := p.updateQuestionBoard(args.ChannelId, func(board *QuestionBoard) bool {
+		q := board.findByID(question.ID)
+		if q == nil {
+			return false
+		}
+		q.PostID = created.Id
+		return true
+	})
+	if appErr != nil {
+		p.API.LogError("Failed to attach post to question", "error", appErr.Error())
+		return &model.CommandResponse{}, nil
+	}
+
+	p.publishQuestions(args.ChannelId, board)
+
+	return &model.CommandResponse{}, nil
+}
+
+// refundQASlot gives back the slot spent by /stick ask when the question is not posted,
+// for example because slow mode or a length cap rejected it.
+func (p *Plugin) refundQASlot(channelID, userID string) {
+	if _, err := p.updateChannelState(channelID, func(state *ChannelState) bool {
+		state.refundQASlot(userID)
+		return true
+	}); err != nil {
+		p.API.LogError("Failed to refund Q&A slot", "channel_id", channelID, "user_id", userID, "error", err.Error())
+	}
+}
+
+// clearQuestionBoard empties the board when the channel is reset or a new Q&A session
+// starts. Question numbers keep counting up so /stick answered never hits a new question
+// with an old number.
+func (p *Plugin) clearQuestionBoard(channelID string) {
+	board, err := p.updateQuestionBoard(channelID, func(board *QuestionBoard) bool {
+		if len(board.Questions) == 0 {
+			return false
+		}
+		board.Questions = []*Question{}
+		return true
+	})
+	if err != nil {
+		p.API.LogError("Failed to clear question board", "channel_id", channelID, "error", err.Error())
+		return
+	}
+	p.publishQuestions(channelID, board)
+}
+
+func (p *Plugin) executeQuestions(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	board, appErr := p.getQuestionBoard(args.ChannelId)
+	if appErr != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to get question board.",
+		}, nil
+	}
+
+	views := p.questionViews(board)
+	if len(views) == 0 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "No questions have been asked yet. Use `/stick ask <question>` to ask one.",
+		}, nil
+	}
+
+	text := "### Questions\n\n"
+	for _, q := range views {
+		status := ""
+		if q.Answered {
+			status = " ✅ _answered_"
+		}
+		text += fmt.Sprintf("- **#%d** (%d :%s:) @%s: %s%s\n", q.ID, q.Votes, UpvoteEmoji, q.Username, q.Text, status)
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         text,
+	}, nil
+}
+
+func (p *Plugin) executeAnswered(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	if response := p.requireModerator(args, "Only moderators can mark questions as answered."); response != nil {
+		return response, nil
+	}
+
+	if len(params) == 0 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Usage: `/stick answered <question number>`",
+		}, nil
+	}
+
+	id, convErr := strconv.Atoi(strings.TrimPrefix(params[0], "#"))
+	if convErr != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Invalid question number.",
+		}, nil
+	}
+
+	found := false
+	board, appErr := p.updateQuestionBoard(args.ChannelId, func(board *QuestionBoard) bool {
+		question := board.findByID(id)
+		found = question != nil && question.PostID != ""
+		if !found {
+			return false
+		}
+		question.Answered = true
+		return true
+	})
+	if appErr != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to mark question as answered.",
+		}, nil
+	}
+	if !found {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("Question #%d not found.", id),
+		}, nil
+	}
+
+	p.publishQuestions(args.ChannelId, board)
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         fmt.Sprintf("Question #%d has been marked as answered.", id),
+	}, nil
+}
+
+func (p *Plugin) ReactionHasBeenAdded(c *plugin.Context, reaction *model.Reaction) {
+	p.updateQuestionVote(reaction, true)
+}
+
+func (p *Plugin) ReactionHasBeenRemoved(c *plugin.Context, reaction *model.Reaction) {
+	p.updateQuestionVote(reaction, false)
+}
+
+func (p *Plugin) updateQuestionVote(reaction *model.Reaction, upvote bool) {
+	if reaction == nil || reaction.EmojiName != UpvoteEmoji {
+		return
+	}
+
+	channelID := reaction.ChannelId
+	if channelID == "" {
+		post, err := p.API.GetPost(reaction.PostId)
+		if err != nil || post == nil {
+			return
+		}
+		channelID = post.ChannelId
+	}
+
+	changed := false
+	board, appErr := p.updateQuestionBoard(channelID, func(board *QuestionBoard) bool {
+		question := board.findByPostID(reaction.PostId)
+		if question == nil || question.UserID == reaction.UserId {
+			changed = false
+			return false // Not a question, or the author voting for themselves
+		}
+
+		if upvote {
+			question.Votes[reaction.UserId] = true
+		} else {
+			delete(question.Votes, reaction.UserId)
+		}
+		changed = true
+		return true
+	})
+	if appErr != nil {
+		p.API.LogError("Failed to update question votes", "channel_id", channelID, "error", appErr.Error())
+		return
+	}
+
+	if changed {
+		p.publishQuestions(channelID, board)
+	}
+}
+
+func (p *Plugin) serveQuestions(w http.ResponseWriter, r *http.Request, userID string) {
+	channelID := r.URL.Query().Get("channel_id")
+	if channelID == "" {
+		http.Error(w, "channel_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := p.API.GetChannelMember(channelID, userID); err != nil {
+		http.Error(w, "not a member of this channel", http.StatusForbidden)
+		return
+	}
+
+	board, appErr := p.getQuestionBoard(channelID)
+	if appErr != nil {
+		http.Error(w, "failed to get question board", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(p.questionViews(board)); err != nil {
+		p.API.LogWarn("Failed to write questions response", "error", err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuestionBoardIsClearedForANewSession(t *testing.T) {
+	for name, run := range map[string]func(p *Plugin, args *model.CommandArgs) (*model.CommandResponse, *model.AppError){
+		"qa mode": func(p *Plugin, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeMode(args, []string{string(ModeQA)})
+		},
+		"reset": func(p *Plugin, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+			return p.executeReset(args)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p, _ := setupStatePlugin(t)
+			api := p.API.(*plugintest.API)
+			api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(true)
+			api.On("PublishWebSocketEvent", "questions_updated", mock.Anything, mock.Anything)
+			args := &model.CommandArgs{UserId: model.NewId(), ChannelId: model.NewId()}
+
+			_, appErr := p.updateQuestionBoard(args.ChannelId, func(board *QuestionBoard) bool {
+				board.Questions = append(board.Questions, &Question{ID: 1, PostID: model.NewId(), Votes: map[string]bool{}})
+				board.NextID = 2
+				return true
+			})
+			require.Nil(t, appErr)
+
+			_, appErr = run(p, args)
+			require.Nil(t, appErr)
+
+			board, appErr := p.getQuestionBoard(args.ChannelId)
+			require.Nil(t, appErr)
+			assert.Empty(t, board.Questions)
+			assert.Equal(t, 2, board.NextID)
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+)
+
+// currentSchemaVersion is the ChannelState schema written by this version of the plugin.
+// To change the stored shape, bump it and append a migration to stateMigrations.
+const currentSchemaVersion = 2
+
+// schemaVersionKey records the schema every stored channel state has been upgraded to.
+const schemaVersionKey = "schema_version"
+
+// stateMigration upgrades decoded channel state JSON by one schema version in place.
+type stateMigration func(raw map[string]any) error
+
+// stateMigrations[i] upgrades schema version i to i+1.
+var stateMigrations = []stateMigration{
+	migrateSpeakersToGrants,
+	migrateSettleLockToScope,
+}
+
+// migrateSpeakersToGrants turns the original `"speakers": {"<id>": true}` into grant records.
+func migrateSpeakersToGrants(raw map[string]any) error {
+	for _, field := range []string{"speakers", "speaker_groups"} {
+		entries, ok := raw[field].(map[string]any)
+		if !ok {
+			continue
+		}
+		for id, value := range entries {
+			switch value := value.(type) {
+			case bool:
+				if value {
+					entries[id] = map[string]any{}
+				} else {
+					delete(entries, id)
+				}
+			case map[string]any:
+				// Already a grant record
+			default:
+				return fmt.Errorf("unexpected %s entry for %s: %v", field, id, value)
+			}
+		}
+	}
+	return nil
+}
+
+// migrateSettleLockToScope replaces the original channel-wide settle, which locked the
+// channel and remembered the mode to restore, with the "all" settle scope.
+func migrateSettleLockToScope(raw map[string]any) error {
+	previousMode, _ := raw["previous_mode"].(string)
+	delete(raw, "previous_mode")
+
+	agents, _ := raw["settle_agents"].([]any)
+	if len(agents) != 1 || agents[0] != "all" {
+		return nil
+	}
+
+	if previousMode == "" {
+		previousMode = string(ModeOpen)
+	}
+	raw["mode"] = previousMode
+	raw["settle_scope"] = SettleScopeAll
+	raw["settle_agents"] = []any{}
+	return nil
+}
+
+// storedSchemaVersion reads just the schema version from stored state.
+func storedSchemaVersion(data []byte) (int, error) {
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, err
+	}
+	return header.SchemaVersion, nil
+}
+
+// migrateStateData upgrades stored channel state JSON to the current schema.
+// Data that is already current is returned unchanged.
+func migrateStateData(data []byte) ([]byte, error) {
+	version, err := storedSchemaVersion(data)
+	if err != nil {
+		return nil, err
+	}
+	if version == currentSchemaVersion {
+		return data, nil
+	}
+	if version > currentSchemaVersion {
+		return nil, fmt.Errorf("channel state schema %d is newer than supported schema %d", version, currentSchemaVersion)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // Keep millisecond timestamps exact
+	var raw map[string]any
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	for ; version < currentSchemaVersion; version++ {
+		if err := stateMigrations[version](raw); err != nil {
+			return nil, fmt.Errorf("migrating channel state from schema %d: %w", version, err)
+		}
+		raw["schema_version"] = version + 1
+	}
+
+	return json.Marshal(raw)
+}
+
+// migrateAllChannelStates upgrades every stored channel state to the current schema.
+// It runs once per schema version across the cluster; reads upgrade lazily until then.
+func (p *Plugin) migrateAllChannelStates() {
+	mutex, err := cluster.NewMutex(p.API, "schema_migration")
+	if err != nil {
+		p.API.LogError("Failed to create schema migration mutex", "error", err.Error())
+		return
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if data, appErr := p.API.KVGet(schemaVersionKey); appErr == nil && data != nil {
+		if done, convErr := strconv.Atoi(string(data)); convErr == nil && done >= currentSchemaVersion {
+			return
+		}
+	}
+
+	channelIDs, appErr := p.listStateChannelIDs()
+	if appErr != nil {
+		p.API.LogError("Failed to list channels for schema migration", "error", appErr.Error())
+		return
+	}
+
+	migrated, failed := 0, 0
+	for _, channelID := range channelIDs {
+		data, appErr := p.API.KVGet(fmt.Sprintf("channel_%s", channelID))
+		if appErr != nil || data == nil {
+			continue
+		}
+		if version, err := storedSchemaVersion(data); err == nil && version == currentSchemaVersion {
+			continue
+		}
+
+		// Loading upgrades the state, so writing it back unchanged stores the new schema
+		if _, appErr := p.updateChannelState(channelID, func(state *ChannelState) bool { return true }); appErr != nil {
+			p.API.LogError("Failed to migrate channel state", "channel_id", channelID, "error", appErr.Error())
+			failed++
+			continue
+		}
+		migrated++
+	}
+
+	p.API.LogInfo("Channel state schema migration finished", "schema_version", currentSchemaVersion, "migrated", migrated, "failed", failed)
+	if failed > 0 {
+		return // Try again on next activation
+	}
+
+	if appErr := p.API.KVSet(schemaVersionKey, []byte(strconv.Itoa(currentSchemaVersion))); appErr != nil {
+		p.API.LogError("Failed to record schema version", "error", appErr.Error())
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateStateData(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		stored   string
+		expected string
+	}{
+		{
+			name:     "0 to 1 turns speaker flags into grants",
+			stored:   `{"mode":"speakers","speakers":{"alice":true,"bob":false},"speaker_groups":{"devs":true}}`,
+			expected: `{"schema_version":2,"mode":"speakers","speakers":{"alice":{}},"speaker_groups":{"devs":{}}}`,
+		},
+		{
+			name:     "1 to 2 turns a channel-wide settle into the all scope",
+			stored:   `{"schema_version":1,"mode":"locked","previous_mode":"qa","settle_agents":["all"],"settle_until":1700000000123}`,
+			expected: `{"schema_version":2,"mode":"qa","settle_scope":"all","settle_agents":[],"settle_until":1700000000123}`,
+		},
+		{
+			name:     "1 to 2 reopens a channel-wide settle without a previous mode",
+			stored:   `{"schema_version":1,"mode":"locked","settle_agents":["all"]}`,
+			expected: `{"schema_version":2,"mode":"open","settle_scope":"all","settle_agents":[]}`,
+		},
+		{
+			name:     "1 to 2 keeps an agent settle",
+			stored:   `{"schema_version":1,"mode":"speakers","previous_mode":"open","settle_agents":["agent"]}`,
+			expected: `{"schema_version":2,"mode":"speakers","settle_agents":["agent"]}`,
+		},
+		{
+			name:     "0 to 2 applies every migration",
+			stored:   `{"mode":"locked","previous_mode":"speakers","speakers":{"alice":true},"settle_agents":["all"]}`,
+			expected: `{"schema_version":2,"mode":"speakers","speakers":{"alice":{}},"settle_scope":"all","settle_agents":[]}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			migrated, err := migrateStateData([]byte(tc.stored))
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(migrated))
+		})
+	}
+
+	t.Run("current schema is returned unchanged", func(t *testing.T) {
+		stored := []byte(`{ "schema_version": 2, "mode": "qa", "speakers": {"alice": {}} }`)
+		migrated, err := migrateStateData(stored)
+		require.NoError(t, err)
+		assert.Equal(t, stored, migrated)
+	})
+
+	t.Run("newer schema is refused", func(t *testing.T) {
+		migrated, err := migrateStateData([]byte(`{"schema_version":3,"mode":"open"}`))
+		assert.Error(t, err)
+		assert.Nil(t, migrated)
+	})
+}
+
+func TestNewerSchemaIsLeftUntouched(t *testing.T) {
+	p, kv := setupStatePlugin(t)
+	p.API.(*plugintest.API).On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	channelID := model.NewId()
+
+	stored := []byte(`{"schema_version":3,"mode":"qa","future_field":true}`)
+	kv.values["channel_"+channelID] = stored
+
+	_, appErr := p.updateChannelState(channelID, func(state *ChannelState) bool {
+		state.Mode = ModeOpen
+		return true
+	})
+	assert.NotNil(t, appErr)
+	assert.Equal(t, stored, kv.values["channel_"+channelID])
+}
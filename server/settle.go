@@ -0,0 +1,614 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+// Settle scopes choose who an untargeted /settle silences.
+const (
+	SettleScopeBots   = "bots"   // Every bot, even bots that bypass the talking stick
+	SettleScopeHumans = "humans" // Humans who cannot bypass the talking stick
+	SettleScopeAll    = "all"    // Both of the above
+)
+
+// Settle durations used when neither the plugin settings nor the channel set them.
+const (
+	defaultSettleDuration = 20 * time.Second
+	defaultSettleMax      = 5 * time.Minute
+)
+
+// SettleLimits overrides the plugin's settle duration settings in one channel. Zero
+// values inherit the plugin settings.
+type SettleLimits struct {
+	DefaultSeconds int `json:"default_seconds"`
+	MaxSeconds     int `json:"max_seconds"`
+}
+
+func (l SettleLimits) isDefault() bool {
+	return l.DefaultSeconds == 0 && l.MaxSeconds == 0
+}
+
+// settleLimits returns the default and maximum settle durations for a channel. A channel
+// may lower the maximum but never raise it above the plugin setting.
+func settleLimits(config *configuration, state *ChannelState) (time.Duration, time.Duration) {
+	maxDuration := defaultSettleMax
+	if config.SettleMaxSeconds > 0 {
+		maxDuration = time.Duration(config.SettleMaxSeconds) * time.Second
+	}
+	if state.SettleLimits.MaxSeconds > 0 {
+		maxDuration = min(maxDuration, time.Duration(state.SettleLimits.MaxSeconds)*time.Second)
+	}
+
+	defaultDuration := defaultSettleDuration
+	if config.SettleDefaultSeconds > 0 {
+		defaultDuration = time.Duration(config.SettleDefaultSeconds) * time.Second
+	}
+	if state.SettleLimits.DefaultSeconds > 0 {
+		defaultDuration = time.Duration(state.SettleLimits.DefaultSeconds) * time.Second
+	}
+
+	return min(defaultDuration, maxDuration), maxDuration
+}
+
+// parseSettleDuration accepts whole seconds ("45") or a Go duration ("90s", "10m").
+func parseSettleDuration(param string) (time.Duration, bool) {
+	if seconds, err := strconv.Atoi(param); err == nil {
+		return time.Duration(seconds) * time.Second, seconds > 0
+	}
+	duration, err := time.ParseDuration(param)
+	if err != nil || duration < time.Second {
+		return 0, false
+	}
+	return duration.Round(time.Second), true
+}
+
+// formatSettleDuration renders a duration for settle messages, e.g. "45 seconds" or "10 minutes".
+func formatSettleDuration(d time.Duration) string {
+	if d >= time.Minute && d%time.Minute == 0 {
+		if d == time.Minute {
+			return "1 minute"
+		}
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	}
+	return fmt.Sprintf("%d seconds", d/time.Second)
+}
+
+// invalidSettleDuration is the error reply for a duration that can't be parsed.
+func invalidSettleDuration(param string) *model.CommandResponse {
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         fmt.Sprintf("Invalid settle duration `%s`. Use seconds or a duration such as `90s` or `10m`.", param),
+	}
+}
+
+// settleActive reports whether a settle is in effect at now.
+func (s *ChannelState) settleActive(now int64) bool {
+	return s.SettleUntil != 0 && now < s.SettleUntil
+}
+
+func (s *ChannelState) clearSettle() {
+	s.SettleUntil = 0
+	s.SettleScope = ""
+	s.SettleAgents = []string{}
+	s.SettleRelease = ""
+}
+
+// clearExpiredSettle drops a settle that has run out and reports whether it did.
+func (s *ChannelState) clearExpiredSettle(now int64) bool {
+	if s.SettleUntil == 0 || s.settleActive(now) {
+		return false
+	}
+	s.clearSettle()
+	return true
+}
+
+// settleReason applies an active channel, team or global settle to a post from userID.
+// Settled bots and named agents vanish silently, so it returns plugin.DismissPostError
+// for them; settled humans are told why. It returns "" when the post is not affected.
+// The second result reports whether the channel's own settle caught the post, as only
+// those posts may be held for release.
+func (p *Plugin) settleReason(channelID, userID string, state *ChannelState, canBypass bool) (string, bool) {
+	if p.isBotUser(userID) {
+		if _, record := p.globalSettleFor(channelID); record != nil {
+			return plugin.DismissPostError, false
+		}
+	}
+
+	if state.isMuted(userID) {
+		return plugin.DismissPostError, false
+	}
+
+	if !state.settleActive(model.GetMillis()) {
+		return "", false
+	}
+
+	if len(state.SettleAgents) > 0 {
+		if user, err := p.API.GetUser(userID); err == nil && user != nil {
+			for _, username := range state.SettleAgents {
+				if strings.EqualFold(username, user.Username) {
+					return plugin.DismissPostError, true
+				}
+			}
+		}
+	}
+
+	isBot := p.isBotUser(userID)
+	switch {
+	case isBot && (state.SettleScope == SettleScopeBots || state.SettleScope == SettleScopeAll):
+		return plugin.DismissPostError, true
+	case !isBot && !canBypass && (state.SettleScope == SettleScopeHumans || state.SettleScope == SettleScopeAll):
+		return "This channel is settled. Please wait a moment before posting.", true
+	default:
+		return "", false
+	}
+}
+
+// mergeSettleScopes combines an active scope with a new one, so settling bots while
+// humans are settled settles everyone.
+func mergeSettleScopes(current, added string) string {
+	switch {
+	case current == "" || current == added:
+		return added
+	case added == "":
+		return current
+	default:
+		// Two different scopes always cover both bots and humans
+		return SettleScopeAll
+	}
+}
+
+// stackSettle adds a settle to the state. A settle that is still active is extended,
+// never shortened, and keeps everyone it already applies to and any hold-and-release.
+func (s *ChannelState) stackSettle(now, until int64, scope string, agents []string, release string) {
+	if !s.settleActive(now) {
+		s.clearSettle()
+	}
+
+	if until > s.SettleUntil {
+		s.SettleUntil = until
+	}
+	s.SettleScope = mergeSettleScopes(s.SettleScope, scope)
+	for _, agent := range agents {
+		if !slices.ContainsFunc(s.SettleAgents, func(existing string) bool { return strings.EqualFold(existing, agent) }) {
+			s.SettleAgents = append(s.SettleAgents, agent)
+		}
+	}
+	if release != "" {
+		s.SettleRelease = release
+	}
+}
+
+// describeSettleTarget names who a settle applies to, for announcements and status.
+func describeSettleTarget(scope string, agents []string) string {
+	var parts []string
+	switch scope {
+	case SettleScopeBots:
+		parts = append(parts, "all bots in the channel")
+	case SettleScopeHumans:
+		parts = append(parts, "humans in the channel")
+	case SettleScopeAll:
+		parts = append(parts, "everyone in the channel")
+	}
+	if len(agents) > 0 {
+		parts = append(parts, "@"+strings.Join(agents, ", @"))
+	}
+	return strings.Join(parts, " and ")
+}
+
+func (p *Plugin) settleHelpResponse() *model.CommandResponse {
+	help := `### Settle Command
+
+Temporarily suppress agent responses to break doom loops.
+
+**Usage:**
+- ` + "`/settle`" + ` - Settle all bots for the default duration (20 seconds unless configured)
+- ` + "`/settle 45`" + ` - Settle all bots for 45 seconds (also ` + "`90s`" + `, ` + "`10m`" + `)
+- ` + "`/settle humans 30`" + ` - Settle humans who can't bypass the talking stick instead
+- ` + "`/settle all 30`" + ` - Settle bots and humans
+- ` + "`/settle @telos`" + ` - Settle specific agent for the default duration
+- ` + "`/settle 30 @telos @aurora`" + ` - Settle specific agents for 30 seconds
+- ` + "`/settle hold 60 @telos`" + ` - Hold settled posts and release them as one digest when the settle ends (` + "`hold-by-author`" + ` for one summary per author)
+- ` + "`/settle +30`" + ` - Extend the current settle by 30 seconds
+- ` + "`/settle off`" + ` - End the current settle now
+- ` + "`/settle team [duration|off]`" + ` - Settle all bots in every channel of this team (team admins)
+- ` + "`/settle global [duration|off]`" + ` - Settle all bots in every channel on the server (system admins)
+- ` + "`/settle purge 5m [@agent...]`" + ` - Delete, or archive into a thread, bot posts from the last 5 minutes
+- ` + "`/settle unmute @agent`" + ` - Lift a mute from an agent settled too often and clear its strikes
+- ` + "`/settle status`" + ` - Check current settle state, including team and global settles
+- ` + "`/settle limits`" + ` - Show or change this channel's default and maximum durations
+
+**Notes:**
+- Only administrators can use this command
+- Maximum settle duration: 5 minutes unless configured
+- Bots are settled even if they normally bypass the talking stick
+- Responses from settled agents will vanish completely, unless the settle holds them
+- Settling again while settled adds to the settle and never shortens it
+- Settling never changes the channel mode
+- Agents settled by name repeatedly within an hour are settled for longer each time, and muted after too many strikes
+- Settle expires silently (no announcement)
+`
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         help,
+	}
+}
+
+func (p *Plugin) executeSettle(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	// Admin check - only admins can use settle
+	if response := p.requireSettlePermission(args); response != nil {
+		return response, nil
+	}
+
+	state, appErr := p.getChannelState(args.ChannelId)
+	if appErr != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to get channel state.",
+		}, nil
+	}
+	config := p.getConfiguration()
+	duration, maxDuration := settleLimits(config, state)
+
+	// Parse params: /settle [bots|humans|all] [duration] [@user1 @user2...]
+	// Examples: /settle, /settle 45, /settle 2m, /settle humans, /settle @telos, /settle 30 @telos @aurora
+
+	scope := ""
+	release := ""
+	var targetUsernames []string
+
+	for _, param := range params {
+		switch {
+		case param == "hold":
+			release = SettleReleaseDigest
+		case param == "hold-by-author":
+			release = SettleReleaseByAuthor
+		case strings.HasPrefix(param, "@"):
+			// It's a username
+			targetUsernames = append(targetUsernames, strings.TrimPrefix(param, "@"))
+		case param == SettleScopeBots || param == SettleScopeHumans || param == SettleScopeAll:
+			scope = param
+		default:
+			parsed, ok := parseSettleDuration(param)
+			if !ok {
+				return invalidSettleDuration(param), nil
+			}
+			if parsed > maxDuration {
+				return &model.CommandResponse{
+					ResponseType: model.CommandResponseTypeEphemeral,
+					Text:         fmt.Sprintf("Settle duration %s is longer than the maximum of %s in this channel.", formatSettleDuration(parsed), formatSettleDuration(maxDuration)),
+				}, nil
+			}
+			duration = parsed
+		}
+	}
+
+	if scope == "" && len(targetUsernames) == 0 {
+		scope = SettleScopeBots
+	}
+
+	// Named agents collect strikes, and repeat offenders are settled for longer
+	agents := p.resolveTargets(targetUsernames, false).users
+	backoff := parseSettleBackoff(config.SettleBackoff)
+
+	// Set settle state; the channel mode is left alone so nothing needs restoring
+	now := model.GetMillis()
+	var stacked bool
+	var settledFor time.Duration
+	var newlyMuted []string
+	state, err := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		stacked = state.settleActive(now)
+
+		settledFor = duration
+		newlyMuted = nil
+		for userID, username := range agents {
+			previous, muted := state.recordStrike(userID, now, config.MuteAfterStrikes)
+			if muted {
+				newlyMuted = append(newlyMuted, "@"+username)
+			}
+			// A first settle uses the requested duration; only repeats escalate
+			if previous > 0 {
+				settledFor = max(settledFor, escalatedDuration(backoff, previous))
+			}
+		}
+		settledFor = min(settledFor, maxDuration)
+
+		state.stackSettle(now, now+settledFor.Milliseconds(), scope, targetUsernames, release)
+		return true
+	})
+	if err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to set settle state.",
+		}, nil
+	}
+
+	if state.SettleRelease != "" {
+		p.scheduleHeldRelease(args.ChannelId, state.SettleUntil)
+	}
+
+	// Build response message
+	issuerUsername := p.issuerUsername(args.UserId)
+	text := fmt.Sprintf("%s has settled %s for %s", issuerUsername, describeSettleTarget(scope, targetUsernames), formatSettleDuration(settledFor))
+	if settledFor > duration {
+		text += " (escalated for repeat settles)"
+	}
+	if release != "" {
+		text += ", holding their posts until it ends"
+	}
+	if stacked {
+		text += fmt.Sprintf(". The settle now covers %s for %d more seconds.", describeSettleTarget(state.SettleScope, state.SettleAgents), remainingSeconds(state, now))
+	}
+	if len(newlyMuted) > 0 {
+		sort.Strings(newlyMuted)
+		text += fmt.Sprintf("\n\n%s %s been settled too often within an hour and %s now muted until a moderator runs `/settle unmute`.", strings.Join(newlyMuted, ", "), pluralize(len(newlyMuted), "has", "have"), pluralize(len(newlyMuted), "is", "are"))
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         text,
+	}, nil
+}
+
+// remainingSeconds is how long the settle has left, rounded up.
+func remainingSeconds(state *ChannelState, now int64) int {
+	return int((state.SettleUntil - now + 999) / 1000)
+}
+
+// executeSettleOff ends an active settle early.
+func (p *Plugin) executeSettleOff(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	if response := p.requireSettlePermission(args); response != nil {
+		return response, nil
+	}
+
+	now := model.GetMillis()
+	var wasActive bool
+	if _, err := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		wasActive = state.settleActive(now)
+		if state.SettleUntil == 0 {
+			return false
+		}
+		state.clearSettle()
+		return true
+	}); err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to end the settle.",
+		}, nil
+	}
+
+	if !wasActive {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Channel is not currently settled.",
+		}, nil
+	}
+	go p.releaseHeldPosts(args.ChannelId)
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         fmt.Sprintf("%s has ended the settle.", p.issuerUsername(args.UserId)),
+	}, nil
+}
+
+// executeSettleExtend lengthens an active settle, e.g. /settle +30.
+func (p *Plugin) executeSettleExtend(args *model.CommandArgs, param string) (*model.CommandResponse, *model.AppError) {
+	if response := p.requireSettlePermission(args); response != nil {
+		return response, nil
+	}
+
+	extension, ok := parseSettleDuration(strings.TrimPrefix(param, "+"))
+	if !ok {
+		return invalidSettleDuration(param), nil
+	}
+
+	now := model.GetMillis()
+	config := p.getConfiguration()
+	var wasActive, tooLong bool
+	var maxDuration time.Duration
+	state, err := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		wasActive = state.settleActive(now)
+		_, maxDuration = settleLimits(config, state)
+		tooLong = state.SettleUntil+extension.Milliseconds() > now+maxDuration.Milliseconds()
+		if !wasActive || tooLong {
+			return false
+		}
+		state.SettleUntil += extension.Milliseconds()
+		return true
+	})
+	if err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to extend the settle.",
+		}, nil
+	}
+
+	if !wasActive {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Channel is not currently settled. Use `/settle` to start one.",
+		}, nil
+	}
+	if tooLong {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("The settle can't be extended past the maximum of %s from now in this channel.", formatSettleDuration(maxDuration)),
+		}, nil
+	}
+	if state.SettleRelease != "" {
+		p.scheduleHeldRelease(args.ChannelId, state.SettleUntil)
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         fmt.Sprintf("%s has extended the settle: %s settled for %d more seconds", p.issuerUsername(args.UserId), describeSettleTarget(state.SettleScope, state.SettleAgents), remainingSeconds(state, now)),
+	}, nil
+}
+
+// requireSettlePermission returns an error response unless the user may manage settles.
+func (p *Plugin) requireSettlePermission(args *model.CommandArgs) *model.CommandResponse {
+	return p.requireModerator(args, "Only administrators can use the settle command.")
+}
+
+// issuerUsername names the user running a command in announcements.
+func (p *Plugin) issuerUsername(userID string) string {
+	if issuer, err := p.API.GetUser(userID); err == nil && issuer != nil {
+		return issuer.Username
+	}
+	return "Someone"
+}
+
+func (p *Plugin) executeSettleStatus(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	state, appErr := p.getChannelState(args.ChannelId)
+	if appErr != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to get channel state.",
+		}, nil
+	}
+
+	now := model.GetMillis()
+
+	var lines []string
+	if global := p.describeGlobalSettle(args.ChannelId); global != "" {
+		lines = append(lines, global)
+	}
+	if muted := p.mutedUsernames(state); len(muted) > 0 {
+		lines = append(lines, fmt.Sprintf("Muted until a moderator unmutes them: %s", strings.Join(muted, ", ")))
+	}
+	if state.settleActive(now) {
+		line := fmt.Sprintf("Settled %s for %d more seconds", describeSettleTarget(state.SettleScope, state.SettleAgents), remainingSeconds(state, now))
+		if state.SettleRelease != "" {
+			line += " (holding posts for release)"
+		}
+		lines = append(lines, line)
+	}
+
+	// Check if settle is active
+	if len(lines) == 0 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Channel is not currently settled.",
+		}, nil
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         strings.Join(lines, "\n"),
+	}, nil
+}
+
+// executeSettleLimits shows or overrides the channel's settle durations:
+// /settle limits [default|max] <duration> or /settle limits reset.
+func (p *Plugin) executeSettleLimits(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	usage := "Usage: `/settle limits [default|max] <duration>` or `/settle limits reset`"
+	config := p.getConfiguration()
+
+	if len(params) == 0 {
+		state, appErr := p.getChannelState(args.ChannelId)
+		if appErr != nil {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         "Failed to get channel state.",
+			}, nil
+		}
+
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("### Settle Limits\n\n%s", describeSettleLimits(config, state)),
+		}, nil
+	}
+
+	if response := p.requireSettlePermission(args); response != nil {
+		return response, nil
+	}
+
+	var apply func(limits *SettleLimits)
+
+	switch {
+	case len(params) == 1 && params[0] == "reset":
+		apply = func(limits *SettleLimits) { *limits = SettleLimits{} }
+
+	case len(params) == 2 && (params[0] == "default" || params[0] == "max"):
+		duration, ok := parseSettleDuration(params[1])
+		if !ok {
+			return invalidSettleDuration(params[1]), nil
+		}
+		seconds := int(duration / time.Second)
+		if params[0] == "default" {
+			apply = func(limits *SettleLimits) { limits.DefaultSeconds = seconds }
+		} else {
+			apply = func(limits *SettleLimits) { limits.MaxSeconds = seconds }
+		}
+
+	default:
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         usage,
+		}, nil
+	}
+
+	var problem string
+	state, appErr := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		limits := state.SettleLimits
+		apply(&limits)
+
+		_, globalMax := settleLimits(config, &ChannelState{})
+		if limits.MaxSeconds > 0 && time.Duration(limits.MaxSeconds)*time.Second > globalMax {
+			problem = fmt.Sprintf("The maximum can't be longer than the server-wide maximum of %s.", formatSettleDuration(globalMax))
+			return false
+		}
+		channelMax := globalMax
+		if limits.MaxSeconds > 0 {
+			channelMax = time.Duration(limits.MaxSeconds) * time.Second
+		}
+		if limits.DefaultSeconds > 0 && time.Duration(limits.DefaultSeconds)*time.Second > channelMax {
+			problem = fmt.Sprintf("The default can't be longer than the maximum of %s.", formatSettleDuration(channelMax))
+			return false
+		}
+
+		state.SettleLimits = limits
+		return true
+	})
+	if appErr != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to update settle limits.",
+		}, nil
+	}
+	if problem != "" {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         problem,
+		}, nil
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         fmt.Sprintf("Settle limits updated.\n\n%s", describeSettleLimits(config, state)),
+	}, nil
+}
+
+// describeSettleLimits renders the effective settle durations, marking channel overrides.
+func describeSettleLimits(config *configuration, state *ChannelState) string {
+	defaultDuration, maxDuration := settleLimits(config, state)
+
+	source := func(override int) string {
+		if override > 0 {
+			return "channel override"
+		}
+		return "plugin setting"
+	}
+
+	return fmt.Sprintf("- Default: %s (%s)\n- Maximum: %s (%s)",
+		formatSettleDuration(defaultDuration), source(state.SettleLimits.DefaultSeconds),
+		formatSettleDuration(maxDuration), source(state.SettleLimits.MaxSeconds))
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// maxSlowModeAttempts bounds the compare-and-set retry loop when recording a post.
+const maxSlowModeAttempts = 5
+
+// RateLimit allows at most Posts messages per author within any Interval-second window.
+type RateLimit struct {
+	Posts    int   `json:"posts"`
+	Interval int64 `json:"interval"` // Seconds
+}
+
+func (r RateLimit) enabled() bool {
+	return r.Posts > 0 && r.Interval > 0
+}
+
+func (r RateLimit) String() string {
+	if !r.enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d post(s) per %s", r.Posts, time.Duration(r.Interval)*time.Second)
+}
+
+// SlowMode holds separate per-author rate limits for humans and bots.
+type SlowMode struct {
+	Humans RateLimit `json:"humans"`
+	Bots   RateLimit `json:"bots"`
+}
+
+func (s SlowMode) enabled() bool {
+	return s.Humans.enabled() || s.Bots.enabled()
+}
+
+// isBotUser reports whether userID belongs to a bot account. Bot-ness never changes,
+// so answers are remembered for the life of the plugin.
+func (p *Plugin) isBotUser(userID string) bool {
+	if isBot, ok := p.botUsers.Load(userID); ok {
+		return isBot.(bool)
+	}
+
+	user, err := p.API.GetUser(userID)
+	if err != nil || user == nil {
+		p.API.LogWarn("Failed to get user for bot check", "user_id", userID, "error", err)
+		return false
+	}
+
+	p.botUsers.Store(userID, user.IsBot)
+	return user.IsBot
+}
+
+// slowModeLimitFor returns the rate limit that applies to userID in the channel, or nil.
+// Bots are always limited; humans who can bypass the talking stick are not.
+func (p *Plugin) slowModeLimitFor(userID string, state *ChannelState, canBypass bool) *RateLimit {
+	if !state.SlowMode.enabled() {
+		return nil
+	}
+
+	if p.isBotUser(userID) {
+		if state.SlowMode.Bots.enabled() {
+			return &state.SlowMode.Bots
+		}
+		return nil
+	}
+
+	if !canBypass && state.SlowMode.Humans.enabled() {
+		return &state.SlowMode.Humans
+	}
+	return nil
+}
+
+func slowModeKey(channelID, userID string) string {
+	return fmt.Sprintf("slowmode_%s_%s", channelID, userID)
+}
+
+// loadSlowModeWindow returns the author's post timestamps still inside the window,
+// along with the raw stored value for compare-and-set.
+func (p *Plugin) loadSlowModeWindow(channelID, userID string, limit RateLimit, now int64) ([]int64, []byte, *model.AppError) {
+	data, appErr := p.API.KVGet(slowModeKey(channelID, userID))
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+
+	var stamps []int64
+	if data != nil {
+		if err := json.Unmarshal(data, &stamps); err != nil {
+			p.API.LogWarn("Discarding unreadable slow mode window", "channel_id", channelID, "user_id", userID, "error", err.Error())
+			stamps = nil
+		}
+	}
+
+	cutoff := now - limit.Interval*1000
+	window := stamps[:0]
+	for _, stamp := range stamps {
+		if stamp > cutoff {
+			window = append(window, stamp)
+		}
+	}
+
+	return window, data, nil
+}
+
+// reserveSlowModePost counts the post against the author's sliding window if it fits,
+// checking and recording in a single compare-and-set so concurrent posts can't both
+// take the last place. It returns the recorded timestamp, to pass to
+// releaseSlowModePost if a later check rejects the post, or a rejection telling the
+// author when they may post again.
+func (p *Plugin) reserveSlowModePost(post *model.Post, limit RateLimit) (int64, string) {
+	key := slowModeKey(post.ChannelId, post.UserId)
+
+	for attempt := 0; attempt < maxSlowModeAttempts; attempt++ {
+		now := model.GetMillis()
+		window, oldData, appErr := p.loadSlowModeWindow(post.ChannelId, post.UserId, limit, now)
+		if appErr != nil {
+			p.API.LogError("Failed to read slow mode window", "error", appErr.Error())
+			return 0, ""
+		}
+
+		if len(window) >= limit.Posts {
+			// The oldest post in the window has to age out before another one fits
+			oldest := window[len(window)-limit.Posts]
+			wait := time.Duration(oldest+limit.Interval*1000-now) * time.Millisecond
+			if wait < time.Second {
+				wait = time.Second
+			}
+			return 0, fmt.Sprintf("Slow mode is on in this channel (%s). You may post again in %s.", limit, wait.Round(time.Second))
+		}
+
+		ok, appErr := p.storeSlowModeWindow(key, oldData, append(window, now), limit)
+		if appErr != nil {
+			p.API.LogError("Failed to record slow mode post", "error", appErr.Error())
+			return 0, ""
+		}
+		if ok {
+			return now, ""
+		}
+	}
+
+	p.API.LogWarn("Gave up recording slow mode post after repeated conflicts", "channel_id", post.ChannelId, "user_id", post.UserId)
+	return 0, ""
+}
+
+// releaseSlowModePost removes a post recorded by reserveSlowModePost that was
+// rejected afterwards, so it doesn't count against the author.
+func (p *Plugin) releaseSlowModePost(post *model.Post, limit RateLimit, stamp int64) {
+	key := slowModeKey(post.ChannelId, post.UserId)
+
+	for attempt := 0; attempt < maxSlowModeAttempts; attempt++ {
+		window, oldData, appErr := p.loadSlowModeWindow(post.ChannelId, post.UserId, limit, model.GetMillis())
+		if appErr != nil {
+			p.API.LogError("Failed to read slow mode window", "error", appErr.Error())
+			return
+		}
+
+		i := slices.Index(window, stamp)
+		if i < 0 {
+			return // Already aged out
+		}
+
+		ok, appErr := p.storeSlowModeWindow(key, oldData, slices.Delete(window, i, i+1), limit)
+		if appErr != nil {
+			p.API.LogError("Failed to release slow mode post", "error", appErr.Error())
+			return
+		}
+		if ok {
+			return
+		}
+	}
+
+	p.API.LogWarn("Gave up releasing slow mode post after repeated conflicts", "channel_id", post.ChannelId, "user_id", post.UserId)
+}
+
+// storeSlowModeWindow writes window if the stored value is still oldData.
+func (p *Plugin) storeSlowModeWindow(key string, oldData []byte, window []int64, limit RateLimit) (bool, *model.AppError) {
+	data, err := json.Marshal(window)
+	if err != nil {
+		return false, model.NewAppError("storeSlowModeWindow", "app.plugin.marshal.app_error", nil, "", 500)
+	}
+
+	return p.API.KVSetWithOptions(key, data, model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        oldData,
+		ExpireInSeconds: limit.Interval,
+	})
+}
+
+func (p *Plugin) executeSlowMode(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	usage := "Usage: `/stick slowmode [humans|bots] <posts> <interval>` or `/stick slowmode [humans|bots] off`"
+
+	if len(params) == 0 {
+		state, err := p.getChannelState(args.ChannelId)
+		if err != nil {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         "Failed to get channel state.",
+			}, nil
+		}
+
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("### Slow Mode\n\n%s", describeSlowMode(state.SlowMode)),
+		}, nil
+	}
+
+	if response := p.requireModerator(args, "Only administrators can change slow mode."); response != nil {
+		return response, nil
+	}
+
+	var apply func(slowMode *SlowMode)
+
+	switch params[0] {
+	case "off":
+		apply = func(slowMode *SlowMode) { *slowMode = SlowMode{} }
+
+	case "humans", "bots":
+		limit, ok := parseRateLimit(params[1:])
+		if !ok {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         usage,
+			}, nil
+		}
+		if params[0] == "humans" {
+			apply = func(slowMode *SlowMode) { slowMode.Humans = limit }
+		} else {
+			apply = func(slowMode *SlowMode) { slowMode.Bots = limit }
+		}
+
+	default:
+		// Without a scope, the same limit applies to humans and bots
+		limit, ok := parseRateLimit(params)
+		if !ok {
+			return &model.CommandResponse{
+				ResponseType: model.CommandResponseTypeEphemeral,
+				Text:         usage,
+			}, nil
+		}
+		apply = func(slowMode *SlowMode) {
+			slowMode.Humans = limit
+			slowMode.Bots = limit
+		}
+	}
+
+	state, err := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		apply(&state.SlowMode)
+		return true
+	})
+	if err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to update slow mode.",
+		}, nil
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         fmt.Sprintf("Slow mode updated.\n\n%s", describeSlowMode(state.SlowMode)),
+	}, nil
+}
+
+// parseRateLimit parses "<posts> <interval>" or "off".
+func parseRateLimit(params []string) (RateLimit, bool) {
+	if len(params) == 1 && params[0] == "off" {
+		return RateLimit{}, true
+	}
+	if len(params) != 2 {
+		return RateLimit{}, false
+	}
+
+	posts, err := strconv.Atoi(params[0])
+	if err != nil || posts < 1 {
+		return RateLimit{}, false
+	}
+
+	interval, err := time.ParseDuration(params[1])
+	if err != nil || interval < time.Second {
+		return RateLimit{}, false
+	}
+
+	return RateLimit{Posts: posts, Interval: int64(interval / time.Second)}, true
+}
+
+func describeSlowMode(slowMode SlowMode) string {
+	return fmt.Sprintf("- **Humans:** %s\n- **Bots:** %s", slowMode.Humans, slowMode.Bots)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// strikeWindow is how long a settle counts against an agent.
+const strikeWindow = time.Hour
+
+// AgentStrikes is an agent's settle history in one channel.
+type AgentStrikes struct {
+	Times   []int64 `json:"times"`              // When the agent was settled, Unix timestamps in milliseconds
+	Muted   bool    `json:"muted"`              // Set after too many strikes; only a moderator can lift it
+	MutedAt int64   `json:"muted_at,omitempty"` // Unix timestamp in milliseconds
+}
+
+// parseSettleBackoff parses the SettleBackoff setting, e.g. "20s, 60s, 5m". Entries that
+// can't be parsed are skipped.
+func parseSettleBackoff(setting string) []time.Duration {
+	var backoff []time.Duration
+	for _, field := range strings.Split(setting, ",") {
+		if duration, ok := parseSettleDuration(strings.TrimSpace(field)); ok {
+			backoff = append(backoff, duration)
+		}
+	}
+	return backoff
+}
+
+// escalatedDuration is the settle duration for an agent with previous recent strikes,
+// so the second settle uses the second step. Once past the end of the backoff, the
+// last step repeats.
+func escalatedDuration(backoff []time.Duration, previous int) time.Duration {
+	if len(backoff) == 0 {
+		return 0
+	}
+	return backoff[min(previous, len(backoff)-1)]
+}
+
+// recordStrike adds a settle to userID's history. It returns how many strikes the agent
+// already had within strikeWindow, and whether this strike muted it.
+func (s *ChannelState) recordStrike(userID string, now int64, muteAfter int) (int, bool) {
+	strikes := s.Strikes[userID]
+	if strikes == nil {
+		strikes = &AgentStrikes{}
+		s.Strikes[userID] = strikes
+	}
+
+	strikes.Times = recentStrikes(strikes.Times, now)
+	previous := len(strikes.Times)
+	strikes.Times = append(strikes.Times, now)
+
+	if muteAfter > 0 && !strikes.Muted && len(strikes.Times) >= muteAfter {
+		strikes.Muted = true
+		strikes.MutedAt = now
+		return previous, true
+	}
+	return previous, false
+}
+
+// pruneStrikes forgets strikes older than strikeWindow and reports whether anything
+// changed. Muted agents are kept until a moderator unmutes them.
+func (s *ChannelState) pruneStrikes(now int64) bool {
+	changed := false
+	for userID, strikes := range s.Strikes {
+		recent := recentStrikes(strikes.Times, now)
+		if len(recent) != len(strikes.Times) {
+			strikes.Times = recent
+			changed = true
+		}
+		if len(strikes.Times) == 0 && !strikes.Muted {
+			delete(s.Strikes, userID)
+			changed = true
+		}
+	}
+	return changed
+}
+
+func recentStrikes(times []int64, now int64) []int64 {
+	recent := []int64{}
+	for _, at := range times {
+		if now-at < strikeWindow.Milliseconds() {
+			recent = append(recent, at)
+		}
+	}
+	return recent
+}
+
+// isMuted reports whether userID has been muted in this channel after repeated settles.
+func (s *ChannelState) isMuted(userID string) bool {
+	strikes := s.Strikes[userID]
+	return strikes != nil && strikes.Muted
+}
+
+// mutedUsernames lists the agents muted in this channel, sorted.
+func (p *Plugin) mutedUsernames(state *ChannelState) []string {
+	var usernames []string
+	for userID, strikes := range state.Strikes {
+		if !strikes.Muted {
+			continue
+		}
+		if user, err := p.API.GetUser(userID); err == nil && user != nil {
+			usernames = append(usernames, "@"+user.Username)
+		}
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+// executeSettleUnmute lifts a mute and clears the strike history: /settle unmute @agent...
+func (p *Plugin) executeSettleUnmute(args *model.CommandArgs, params []string) (*model.CommandResponse, *model.AppError) {
+	if response := p.requireSettlePermission(args); response != nil {
+		return response, nil
+	}
+
+	if len(params) == 0 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Usage: `/settle unmute @agent [@agent...]`",
+		}, nil
+	}
+
+	targets := p.resolveTargets(params, false)
+	if len(targets.notFound) > 0 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("User not found: %s", strings.Join(targets.notFound, ", ")),
+		}, nil
+	}
+
+	var unmuted []string
+	if _, appErr := p.updateChannelState(args.ChannelId, func(state *ChannelState) bool {
+		unmuted = nil
+		for userID, username := range targets.users {
+			if _, ok := state.Strikes[userID]; !ok {
+				continue
+			}
+			if state.isMuted(userID) {
+				unmuted = append(unmuted, "@"+username)
+			}
+			delete(state.Strikes, userID)
+		}
+		return true
+	}); appErr != nil {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         "Failed to unmute.",
+		}, nil
+	}
+
+	if len(unmuted) == 0 {
+		return &model.CommandResponse{
+			ResponseType: model.CommandResponseTypeEphemeral,
+			Text:         fmt.Sprintf("%s %s not muted. Their settle history has been cleared.", targets.mentions(), pluralize(len(targets.users), "is", "are")),
+		}, nil
+	}
+
+	sort.Strings(unmuted)
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeInChannel,
+		Text:         fmt.Sprintf("%s has unmuted %s and cleared their settle history.", p.issuerUsername(args.UserId), strings.Join(unmuted, ", ")),
+	}, nil
+}
@@ -1,2 +1 @@
-/*! For license information please see main.js.LICENSE.txt */
-(()=>{"use strict";var e={20(e,r,t){var n=t(594),i=Symbol.for("react.element"),o=(Symbol.for("react.fragment"),Object.prototype.hasOwnProperty),s=n.__SECRET_INTERNALS_DO_NOT_USE_OR_YOU_WILL_BE_FIRED.ReactCurrentOwner,c={key:!0,ref:!0,__self:!0,__source:!0};function a(e,r,t){var n,a={},u=null,l=null;for(n in void 0!==t&&(u=""+t),void 0!==r.key&&(u=""+r.key),void 0!==r.ref&&(l=r.ref),r)o.call(r,n)&&!c.hasOwnProperty(n)&&(a[n]=r[n]);if(e&&e.defaultProps)for(n in r=e.defaultProps)void 0===a[n]&&(a[n]=r[n]);return{$$typeof:i,type:e,key:u,ref:l,props:a,_owner:s.current}}r.jsx=a,r.jsxs=a},594(e){e.exports=React},848(e,r,t){e.exports=t(20)}},r={};function t(n){var i=r[n];if(void 0!==i)return i.exports;var o=r[n]={exports:{}};return e[n](o,o.exports,t),o.exports}t.g=function(){if("object"==typeof globalThis)return globalThis;try{return this||new Function("return this")()}catch(e){if("object"==typeof window)return window}}(),t(594);var n=t(848);function i(){return(0,n.jsxs)("div",{style:{padding:"20px"},children:[(0,n.jsx)("h3",{children:"🎙️ Talking Stick"}),(0,n.jsxs)("div",{style:{marginTop:"20px"},children:[(0,n.jsx)("h4",{children:"Current Speaker"}),(0,n.jsx)("p",{style:{color:"#888"},children:"No one has the floor"})]}),(0,n.jsxs)("div",{style:{marginTop:"20px"},children:[(0,n.jsx)("h4",{children:"Queue"}),(0,n.jsx)("p",{style:{color:"#888"},children:"No one waiting"})]}),(0,n.jsx)("div",{style:{marginTop:"20px"},children:(0,n.jsx)("p",{style:{fontSize:"12px",color:"#666"},children:"Facilitator controls coming soon..."})})]})}function o(){return(0,n.jsx)("span",{style:{fontSize:"18px"},children:"🎙️"})}const s=Redux,c={queue:[],currentSpeaker:null,metrics:{}},a=(0,s.combineReducers)({talkingStick:function(e=c,r){switch(r.type){case"QUEUE_UPDATED":return{...e,queue:r.data};case"SPEAKER_CHANGED":return{...e,currentSpeaker:r.data};case"METRICS_UPDATED":return{...e,metrics:r.data};default:return e}}}),{id:u}={id:"com.gitschool.talking-stick",version:"0.2.6"};t.g.window.registerPlugin(u,new class{async initialize(e,r){e.registerReducer(a);const{showRHSPlugin:t}=e.registerRightHandSidebarComponent(i,"Talking Stick");e.registerChannelHeaderButtonAction(o,()=>r.dispatch(t),"Talking Stick Queue","Talking Stick Queue"),e.registerWebSocketEventHandler(`custom_${u}_queue_updated`,function(e){return r=>{const t=JSON.parse(r.data);e.dispatch({type:"QUEUE_UPDATED",data:t.queue}),t.currentSpeaker&&e.dispatch({type:"SPEAKER_CHANGED",data:t.currentSpeaker})}}(r))}deinitialize(){}})})();
\ No newline at end of file
+"use strict";(()=>{var Q=Object.create;var g=Object.defineProperty;var A=Object.getOwnPropertyDescriptor;var C=Object.getOwnPropertyNames;var N=Object.getPrototypeOf,P=Object.prototype.hasOwnProperty;var p=(t,e)=>()=>(e||t((e={exports:{}}).exports,e),e.exports);var $=(t,e,o,n)=>{if(e&&typeof e=="object"||typeof e=="function")for(let r of C(e))!P.call(t,r)&&r!==o&&g(t,r,{get:()=>e[r],enumerable:!(n=A(e,r))||n.enumerable});return t};var a=(t,e,o)=>(o=t!=null?Q(N(t)):{},$(e||!t||!t.__esModule?g(o,"default",{value:t,enumerable:!0}):o,t));var l=p((B,S)=>{S.exports=window.React});var x=p((G,k)=>{k.exports=window.ReactRedux});var v=p((L,_)=>{_.exports=window.Redux});var i=a(l()),s=a(x());function E(t){return{type:"QUEUE_UPDATED",data:t}}function U(t){return{type:"SPEAKER_CHANGED",data:t}}function d(t,e){return{type:"QUESTIONS_UPDATED",channelId:t,data:e}}var b={id:"com.gitschool.talking-stick",version:"0.2.6"},u=b;var{id:T}=u;function c(){let t=(0,s.useDispatch)(),e=(0,s.useSelector)(n=>n.entities.channels.currentChannelId),o=(0,s.useSelector)(n=>n[`plugins-${T}`].talkingStick.questions[e]||[]);return(0,i.useEffect)(()=>{e&&fetch(`/plugins/${T}/api/v1/questions?channel_id=${e}`,{credentials:"same-origin"}).then(n=>n.ok?n.json():[]).then(n=>t(d(e,n))).catch(()=>{})},[e]),i.default.createElement("div",{style:{padding:"20px"}},i.default.createElement("h3",null,"🎙️ Talking Stick"),i.default.createElement("div",{style:{marginTop:"20px"}},i.default.createElement("h4",null,"Current Speaker"),i.default.createElement("p",{style:{color:"#888"}},"No one has the floor")),i.default.createElement("div",{style:{marginTop:"20px"}},i.default.createElement("h4",null,"Queue"),i.default.createElement("p",{style:{color:"#888"}},"No one waiting")),i.default.createElement("div",{style:{marginTop:"20px"}},i.default.createElement("h4",null,"Questions"),o.length===0?i.default.createElement("p",{style:{color:"#888"}},"No questions yet"):i.default.createElement("ol",{style:{paddingLeft:"20px"}},o.map(n=>i.default.createElement("li",{key:n.id,style:{marginBottom:"8px",opacity:n.answered?.5:1}},i.default.createElement("strong",null,`👍 ${n.votes}`),` #${n.id} @${n.username}: ${n.text}`,n.answered&&i.default.createElement("em",null," (answered)"))))),i.default.createElement("div",{style:{marginTop:"20px"}},i.default.createElement("p",{style:{fontSize:"12px",color:"#666"}},"Facilitator controls coming soon...")))}var y=a(l());function m(){return y.default.createElement("span",{style:{fontSize:"18px"}},"🎙️")}var w=a(v()),H={queue:[],currentSpeaker:null,metrics:{},questions:{}};function z(t=H,e){switch(e.type){case"QUEUE_UPDATED":return{...t,queue:e.data};case"SPEAKER_CHANGED":return{...t,currentSpeaker:e.data};case"METRICS_UPDATED":return{...t,metrics:e.data};case"QUESTIONS_UPDATED":return{...t,questions:{...t.questions,[e.channelId]:e.data}};default:return t}}var D=(0,w.combineReducers)({talkingStick:z});function q(t){return e=>{let o=JSON.parse(e.data);t.dispatch(E(o.queue)),o.currentSpeaker&&t.dispatch(U(o.currentSpeaker))}}function I(t){return e=>{let{channel_id:o,questions:n}=e.data;t.dispatch(d(o,JSON.parse(n)))}}var{id:h}=u,f=class{async initialize(e,o){e.registerReducer(D);let{showRHSPlugin:n}=e.registerRightHandSidebarComponent(c,"Talking Stick");e.registerChannelHeaderButtonAction(m,()=>o.dispatch(n),"Talking Stick Queue","Talking Stick Queue"),e.registerWebSocketEventHandler(`custom_${h}_queue_updated`,q(o)),e.registerWebSocketEventHandler(`custom_${h}_questions_updated`,I(o))}deinitialize(){}};globalThis.window.registerPlugin(h,new f);})();
@@ -18,3 +18,11 @@ export function metricsUpdated(metrics) {
         data: metrics,
     };
 }
+
+export function questionsUpdated(channelId, questions) {
+    return {
+        type: 'QUESTIONS_UPDATED',
+        channelId,
+        data: questions,
+    };
+}
@@ -1,6 +1,26 @@
-import React from 'react';
+import React, {useEffect} from 'react';
+import {useDispatch, useSelector} from 'react-redux';
+
+import {questionsUpdated} from '../../actions';
+import manifest from '../../manifest';
+
+const {id: pluginId} = manifest;
 
 export default function SidebarRight() {
+    const dispatch = useDispatch();
+    const channelId = useSelector((state) => state.entities.channels.currentChannelId);
+    const questions = useSelector((state) => state[`plugins-${pluginId}`].talkingStick.questions[channelId] || []);
+
+    useEffect(() => {
+        if (!channelId) {
+            return;
+        }
+        fetch(`/plugins/${pluginId}/api/v1/questions?channel_id=${channelId}`, {credentials: 'same-origin'}).
+            then((response) => (response.ok ? response.json() : [])).
+            then((data) => dispatch(questionsUpdated(channelId, data))).
+            catch(() => {});
+    }, [channelId]);
+
     return (
         <div style={{padding: '20px'}}>
             <h3>🎙️ Talking Stick</h3>
@@ -12,6 +32,24 @@ export default function SidebarRight() {
                 <h4>Queue</h4>
                 <p style={{color: '#888'}}>No one waiting</p>
             </div>
+            <div style={{marginTop: '20px'}}>
+                <h4>Questions</h4>
+                {questions.length === 0 ? (
+                    <p style={{color: '#888'}}>No questions yet</p>
+                ) : (
+                    <ol style={{paddingLeft: '20px'}}>
+                        {questions.map((q) => (
+                            <li
+                                key={q.id}
+                                style={{marginBottom: '8px', opacity: q.answered ? 0.5 : 1}}
+                            >
+                                <strong>{`👍 ${q.votes}`}</strong>{` #${q.id} @${q.username}: ${q.text}`}
+                                {q.answered && <em>{' (answered)'}</em>}
+                            </li>
+                        ))}
+                    </ol>
+                )}
+            </div>
             <div style={{marginTop: '20px'}}>
                 <p style={{fontSize: '12px', color: '#666'}}>
                     Facilitator controls coming soon...
@@ -1,7 +1,7 @@
 import SidebarRight from './components/sidebar_right';
 import TalkingStickIcon from './components/icon';
 import Reducer from './reducers';
-import {handleQueueUpdate} from './websocket';
+import {handleQueueUpdate, handleQuestionsUpdate} from './websocket';
 import manifest from './manifest';
 
 const {id: pluginId} = manifest;
@@ -30,6 +30,10 @@ class PluginClass {
             `custom_${pluginId}_queue_updated`,
             handleQueueUpdate(store)
         );
+        registry.registerWebSocketEventHandler(
+            `custom_${pluginId}_questions_updated`,
+            handleQuestionsUpdate(store)
+        );
     }
 
     deinitialize() {
@@ -4,6 +4,7 @@ const initialState = {
     queue: [],
     currentSpeaker: null,
     metrics: {},
+    questions: {},
 };
 
 function talkingStick(state = initialState, action) {
@@ -14,6 +15,8 @@ function talkingStick(state = initialState, action) {
         return {...state, currentSpeaker: action.data};
     case 'METRICS_UPDATED':
         return {...state, metrics: action.data};
+    case 'QUESTIONS_UPDATED':
+        return {...state, questions: {...state.questions, [action.channelId]: action.data}};
     default:
         return state;
     }
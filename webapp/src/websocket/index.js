@@ -1,4 +1,4 @@
-import {queueUpdated, speakerChanged} from '../actions';
+import {queueUpdated, speakerChanged, questionsUpdated} from '../actions';
 
 export function handleQueueUpdate(store) {
     return (event) => {
@@ -9,3 +9,10 @@ export function handleQueueUpdate(store) {
         }
     };
 }
+
+export function handleQuestionsUpdate(store) {
+    return (event) => {
+        const {channel_id: channelId, questions} = event.data;
+        store.dispatch(questionsUpdated(channelId, JSON.parse(questions)));
+    };
+}